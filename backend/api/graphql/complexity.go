@@ -0,0 +1,234 @@
+package graphql
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/avnpl/go-march/config"
+	"github.com/avnpl/go-march/services"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Cost model: a field returning an object costs 1 and a scalar is free. A
+// mutation costs mutationCost. A paged field costs its page size times what
+// it selects, since each item repeats the selection.
+const mutationCost = 10
+
+// maxIntrospectionDepth caps __schema and __type selections instead of the
+// configured depth, which tools loading the schema nest deeper than any query
+// of ours needs.
+const maxIntrospectionDepth = 15
+
+// pageSize is how a paged field sizes its page: the argument, its default and
+// the largest page the service serves.
+type pageSize struct {
+	arg      string
+	fallback int
+	max      int
+}
+
+var pagedFields = map[string]pageSize{
+	"Query.getAllProducts": {"limit", services.DefaultProductPageSize, services.MaxProductPageSize},
+	"Query.products":       {"limit", services.DefaultProductPageSize, services.MaxProductPageSize},
+	"Query.orders":         {"first", services.DefaultOrderPageSize, services.MaxOrderPageSize},
+}
+
+// complexity is what an operation would cost to execute.
+type complexity struct {
+	Depth              int
+	IntrospectionDepth int
+	Aliases            int
+	Cost               int
+}
+
+// measure walks the selected operation of a validated document, following
+// fragments. Only __typename is free; introspection is charged like any other
+// field but has its own depth cap.
+func measure(doc *ast.Document, op *ast.OperationDefinition, variables map[string]interface{}) complexity {
+	m := measurer{fragments: make(map[string]*ast.FragmentDefinition), variables: variables}
+	for _, def := range doc.Definitions {
+		if frag, ok := def.(*ast.FragmentDefinition); ok {
+			m.fragments[frag.Name.Value] = frag
+		}
+	}
+
+	var root *graphql.Object
+	switch op.Operation {
+	case ast.OperationTypeMutation:
+		root = Schema.MutationType()
+	case ast.OperationTypeSubscription:
+		root = Schema.SubscriptionType()
+	default:
+		root = Schema.QueryType()
+	}
+	cost, depth := m.selections(op.SelectionSet, root, 1)
+	return complexity{Depth: depth, IntrospectionDepth: m.introspectionDepth, Aliases: m.aliases, Cost: cost}
+}
+
+type measurer struct {
+	fragments          map[string]*ast.FragmentDefinition
+	variables          map[string]interface{}
+	aliases            int
+	introspectionDepth int
+}
+
+// selections returns the cost of a selection set on parent and the depth of
+// its deepest field, the set itself being at depth.
+func (m *measurer) selections(set *ast.SelectionSet, parent graphql.Type, depth int) (int, int) {
+	if set == nil {
+		return 0, depth - 1
+	}
+	cost, deepest := 0, depth-1
+	for _, sel := range set.Selections {
+		var c, d int
+		switch sel := sel.(type) {
+		case *ast.Field:
+			c, d = m.field(sel, parent, depth)
+		case *ast.InlineFragment:
+			c, d = m.selections(sel.SelectionSet, fragmentType(sel.TypeCondition, parent), depth)
+		case *ast.FragmentSpread:
+			if frag, ok := m.fragments[sel.Name.Value]; ok {
+				c, d = m.selections(frag.SelectionSet, fragmentType(frag.TypeCondition, parent), depth)
+			}
+		}
+		cost += c
+		deepest = max(deepest, d)
+	}
+	return cost, deepest
+}
+
+func (m *measurer) field(f *ast.Field, parent graphql.Type, depth int) (int, int) {
+	name := f.Name.Value
+	if f.Alias != nil && f.Alias.Value != name {
+		m.aliases++
+	}
+	if name == "__typename" {
+		return 0, depth - 1
+	}
+
+	obj, ok := parent.(*graphql.Object)
+	if !ok {
+		return 0, depth
+	}
+	var def *graphql.FieldDefinition
+	switch name {
+	case "__schema":
+		def = graphql.SchemaMetaFieldDef
+	case "__type":
+		def = graphql.TypeMetaFieldDef
+	default:
+		def = obj.Fields()[name]
+	}
+	if def == nil {
+		return 0, depth
+	}
+	named, _ := graphql.GetNamed(def.Type).(graphql.Type)
+	childCost, deepest := m.selections(f.SelectionSet, named, depth+1)
+	if def == graphql.SchemaMetaFieldDef || def == graphql.TypeMetaFieldDef {
+		m.introspectionDepth = max(m.introspectionDepth, deepest)
+		deepest = depth
+	}
+
+	cost := 0
+	if _, ok := named.(*graphql.Object); ok {
+		cost = 1
+	}
+	if obj == Schema.MutationType() {
+		cost = mutationCost
+	}
+	if page, ok := pagedFields[obj.Name()+"."+name]; ok {
+		childCost *= m.pageSize(f, page)
+	}
+	return cost + childCost, max(depth, deepest)
+}
+
+// pageSize reads a page size argument. A size the service would reject is
+// counted as its largest page.
+func (m *measurer) pageSize(f *ast.Field, page pageSize) int {
+	for _, arg := range f.Arguments {
+		if arg.Name.Value != page.arg {
+			continue
+		}
+		var n int
+		switch v := arg.Value.(type) {
+		case *ast.IntValue:
+			fmt.Sscan(v.Value, &n)
+		case *ast.Variable:
+			switch val := m.variables[v.Name.Value].(type) {
+			case float64:
+				n = int(val)
+			case int:
+				n = val
+			case json.Number:
+				i, _ := val.Int64()
+				n = int(i)
+			}
+		}
+		if n == 0 {
+			return page.fallback
+		}
+		if n < 0 || n > page.max {
+			return page.max
+		}
+		return n
+	}
+	return page.fallback
+}
+
+func fragmentType(cond *ast.Named, parent graphql.Type) graphql.Type {
+	if cond == nil {
+		return parent
+	}
+	if t := Schema.Type(cond.Name.Value); t != nil {
+		return t
+	}
+	return parent
+}
+
+// Limits bounds what a single operation may cost.
+type Limits struct {
+	MaxDepth   int
+	MaxAliases int
+	MaxCost    int
+}
+
+func NewLimits(cfg config.GraphQLConfig) Limits {
+	return Limits{MaxDepth: cfg.MaxDepth, MaxAliases: cfg.MaxAliases, MaxCost: cfg.MaxCost}
+}
+
+// check reports every limit c breaks, with the QUERY_TOO_COMPLEX code.
+func (l Limits) check(c complexity) []gqlerrors.FormattedError {
+	var errs []gqlerrors.FormattedError
+	add := func(format string, args ...interface{}) {
+		err := gqlerrors.NewFormattedError(fmt.Sprintf(format, args...))
+		err.Extensions = map[string]interface{}{"code": "QUERY_TOO_COMPLEX"}
+		errs = append(errs, err)
+	}
+	if c.Depth > l.MaxDepth {
+		add("Query depth %d exceeds the maximum of %d", c.Depth, l.MaxDepth)
+	}
+	if c.IntrospectionDepth > maxIntrospectionDepth {
+		add("Introspection depth %d exceeds the maximum of %d", c.IntrospectionDepth, maxIntrospectionDepth)
+	}
+	if c.Aliases > l.MaxAliases {
+		add("Query uses %d aliases, the maximum is %d", c.Aliases, l.MaxAliases)
+	}
+	if c.Cost > l.MaxCost {
+		add("Query cost %d exceeds the maximum of %d", c.Cost, l.MaxCost)
+	}
+	return errs
+}
+
+// extensions is the cost report added to every response.
+func (l Limits) extensions(c complexity) map[string]interface{} {
+	return map[string]interface{}{
+		"cost": map[string]interface{}{
+			"requested": c.Cost,
+			"maximum":   l.MaxCost,
+			"depth":     c.Depth,
+			"aliases":   c.Aliases,
+		},
+	}
+}
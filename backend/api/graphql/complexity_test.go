@@ -0,0 +1,161 @@
+package graphql
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/graphql-go/graphql/language/parser"
+	"go.uber.org/zap"
+)
+
+// TestMain builds the schema once. No test reaches a resolver, so it goes
+// without services.
+func TestMain(m *testing.M) {
+	if err := NewSchema(nil, nil, nil, nil, zap.NewNop(), nil); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func TestMeasure(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		want      complexity
+	}{
+		{
+			name:  "scalars are free",
+			query: `{ getProductByID(id: "PR1") { prod_id price } }`,
+			want:  complexity{Depth: 2, Cost: 1},
+		},
+		{
+			name:  "page multiplies its selection",
+			query: `{ orders(first: 10) { orders { order_id product { prod_name } } } }`,
+			want:  complexity{Depth: 4, Cost: 21},
+		},
+		{
+			name:  "page without a size uses the default",
+			query: `{ orders { orders { product { prod_name } } } }`,
+			want:  complexity{Depth: 4, Cost: 41},
+		},
+		{
+			name:      "page size from a variable",
+			query:     `query($n: Int) { orders(first: $n) { orders { product { prod_name } } } }`,
+			variables: map[string]interface{}{"n": float64(50)},
+			want:      complexity{Depth: 4, Cost: 101},
+		},
+		{
+			name:      "page size over the maximum counts as the maximum",
+			query:     `query($n: Int) { orders(first: $n) { orders { product { prod_name } } } }`,
+			variables: map[string]interface{}{"n": float64(1000)},
+			want:      complexity{Depth: 4, Cost: 201},
+		},
+		{
+			name: "fragment spread",
+			query: `query { orders(first: 10) { ...page } }
+				fragment page on OrderPage { orders { product { prod_id } } }`,
+			want: complexity{Depth: 4, Cost: 21},
+		},
+		{
+			name:  "inline fragment",
+			query: `{ orders(first: 10) { ... on OrderPage { orders { product { prod_id } } } } }`,
+			want:  complexity{Depth: 4, Cost: 21},
+		},
+		{
+			name:  "aliases",
+			query: `{ a: getProductByID(id: "1") { prod_id } b: getProductByID(id: "2") { prod_id } getProductByID(id: "3") { prod_id } }`,
+			want:  complexity{Depth: 2, Aliases: 2, Cost: 3},
+		},
+		{
+			name:  "typename is free",
+			query: `{ __typename getProductByID(id: "1") { __typename } }`,
+			want:  complexity{Depth: 1, Cost: 1},
+		},
+		{
+			name:  "aliased typename still counts as an alias",
+			query: `{ t: __typename }`,
+			want:  complexity{Aliases: 1},
+		},
+		{
+			name:  "introspection has its own depth",
+			query: `{ __schema { types { name fields { name } } } }`,
+			want:  complexity{Depth: 1, IntrospectionDepth: 4, Cost: 3},
+		},
+		{
+			name:  "mutation",
+			query: `mutation { deleteProduct(id: "PR1") { prod_id } }`,
+			want:  complexity{Depth: 2, Cost: mutationCost},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parser.Parse(parser.ParseParams{Source: tt.query})
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			op, err := selectOperation(doc, "")
+			if err != nil {
+				t.Fatalf("selectOperation: %v", err)
+			}
+			if got := measure(doc, op, tt.variables); got != tt.want {
+				t.Errorf("measure = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimitsCheck(t *testing.T) {
+	limits := Limits{MaxDepth: 3, MaxAliases: 1, MaxCost: 50}
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{name: "within", query: `{ orders(first: 10) { orders { order_id } } }`},
+		{name: "too deep", query: `{ orders(first: 1) { orders { product { prod_id } } } }`, want: 1},
+		{name: "too costly", query: `{ products(limit: 100) { products { prod_id } } }`, want: 1},
+		{
+			name: "too costly through a fragment",
+			query: `query { orders(first: 60) { ...page } }
+				fragment page on OrderPage { orders { order_id } next_cursor }`,
+			want: 1,
+		},
+		{
+			name: "deep and costly through fragments",
+			query: `query { orders(first: 30) { ...page } }
+				fragment page on OrderPage { orders { ...order } }
+				fragment order on Order { product { prod_id } }`,
+			want: 2,
+		},
+		{name: "too many aliases", query: `{ a: order(id: "1") { order_id } b: order(id: "2") { order_id } }`, want: 1},
+		{
+			// __type, fields, type, 12 ofType and name nest 16 deep.
+			name:  "deep introspection",
+			query: `{ __type(name: "Order") { fields { type { ` + strings.Repeat("ofType { ", 12) + "name" + strings.Repeat(" }", 15) + " }",
+			want:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parser.Parse(parser.ParseParams{Source: tt.query})
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			op, err := selectOperation(doc, "")
+			if err != nil {
+				t.Fatalf("selectOperation: %v", err)
+			}
+			errs := limits.check(measure(doc, op, nil))
+			if len(errs) != tt.want {
+				t.Fatalf("check reported %d errors, want %d: %v", len(errs), tt.want, errs)
+			}
+			for _, err := range errs {
+				if err.Extensions["code"] != "QUERY_TOO_COMPLEX" {
+					t.Errorf("code = %v, want QUERY_TOO_COMPLEX", err.Extensions["code"])
+				}
+			}
+		})
+	}
+}
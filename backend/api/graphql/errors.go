@@ -0,0 +1,38 @@
+package graphql
+
+import (
+	"github.com/avnpl/go-march/utils"
+	"github.com/graphql-go/graphql"
+)
+
+// resolverError is what clients see of a failed resolver: the same message,
+// code and field the REST API would report, in the error's extensions.
+type resolverError struct {
+	res utils.ErrorResponse
+}
+
+func (e resolverError) Error() string {
+	return e.res.Message
+}
+
+func (e resolverError) Extensions() map[string]interface{} {
+	ext := map[string]interface{}{"code": e.res.Code}
+	if e.res.Field != "" {
+		ext["field"] = e.res.Field
+	}
+	if len(e.res.Violations) > 0 {
+		ext["violations"] = e.res.Violations
+	}
+	return ext
+}
+
+// fail logs err and returns its client-facing form.
+func (r *Resolver) fail(p graphql.ResolveParams, err error) error {
+	r.logError(p, err)
+	return clientError(err)
+}
+
+// clientError is the client-facing form of an error that was logged already.
+func clientError(err error) error {
+	return resolverError{res: utils.MapError(err)}
+}
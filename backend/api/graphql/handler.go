@@ -0,0 +1,239 @@
+package graphql
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/avnpl/go-march/config"
+	"github.com/avnpl/go-march/metrics"
+	"github.com/avnpl/go-march/utils"
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"go.uber.org/zap"
+)
+
+const (
+	graphQLResponseType = "application/graphql-response+json"
+	jsonType            = "application/json"
+)
+
+// Handler serves /graphql following the GraphQL-over-HTTP spec: queries by GET
+// or POST, mutations by POST only, variables and operationName honoured, and
+// application/graphql-response+json when the client accepts it. Subscriptions
+// are served on the same path over WebSocket with graphql-transport-ws.
+// Operations over the configured depth, alias or cost limits are refused
+// before they run.
+type Handler struct {
+	metrics      *metrics.Metrics
+	maxBodyBytes int64
+	limits       Limits
+	maxOps       int
+	sockets      *wsConns
+	log          *zap.Logger
+}
+
+func NewHandler(m *metrics.Metrics, cfg config.GraphQLConfig, log *zap.Logger) Handler {
+	return Handler{
+		metrics:      m,
+		maxBodyBytes: int64(cfg.MaxBodyBytes),
+		limits:       NewLimits(cfg),
+		maxOps:       cfg.MaxSubscriptions,
+		sockets:      &wsConns{conns: make(map[*wsConn]struct{})},
+		log:          log,
+	}
+}
+
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+	Extensions    map[string]interface{} `json:"extensions"`
+}
+
+// requestError is a response for a request that never got to execution. It
+// has no data entry, which is how clients tell it from a failed execution.
+type requestError struct {
+	Errors     []gqlerrors.FormattedError `json:"errors"`
+	Extensions map[string]interface{}     `json:"extensions,omitempty"`
+}
+
+func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		h.serveWebSocket(w, r)
+		return
+	}
+	log := utils.LoggerFrom(r.Context(), h.log)
+
+	mediaType, ok := responseType(r.Header.Get("Accept"))
+	if !ok {
+		utils.SendJSONError(w, http.StatusNotAcceptable, "Accept application/graphql-response+json or application/json")
+		return
+	}
+
+	var req request
+	switch r.Method {
+	case http.MethodGet:
+		if int64(len(r.URL.RawQuery)) > h.maxBodyBytes {
+			h.sendRequestError(w, mediaType, http.StatusRequestURITooLong, "Query string is too large")
+			return
+		}
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		for param, dst := range map[string]*map[string]interface{}{"variables": &req.Variables, "extensions": &req.Extensions} {
+			if raw := q.Get(param); raw != "" {
+				if err := json.Unmarshal([]byte(raw), dst); err != nil {
+					h.sendRequestError(w, mediaType, http.StatusBadRequest, fmt.Sprintf("%s must be a JSON object", param))
+					return
+				}
+			}
+		}
+	case http.MethodPost:
+		contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if contentType != jsonType {
+			h.sendRequestError(w, mediaType, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+			return
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, h.maxBodyBytes)).Decode(&req); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				h.sendRequestError(w, mediaType, http.StatusRequestEntityTooLarge, "Request body is too large")
+				return
+			}
+			log.Error("failed to decode GraphQL request", zap.Error(err))
+			h.sendRequestError(w, mediaType, http.StatusBadRequest, "Request body must be a JSON object with a query")
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		h.sendRequestError(w, mediaType, http.StatusMethodNotAllowed, "Use GET or POST")
+		return
+	}
+
+	if strings.TrimSpace(req.Query) == "" {
+		h.sendRequestError(w, mediaType, http.StatusBadRequest, "Query cannot be empty")
+		return
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{
+		Body: []byte(req.Query),
+		Name: "GraphQL request",
+	})})
+	if err != nil {
+		h.metrics.ObserveGraphQL(req.OperationName, "", 1)
+		h.sendErrors(w, mediaType, gqlerrors.FormatErrors(err), nil)
+		return
+	}
+
+	op, err := selectOperation(doc, req.OperationName)
+	if err != nil {
+		h.metrics.ObserveGraphQL(req.OperationName, "", 1)
+		h.sendRequestError(w, mediaType, http.StatusBadRequest, err.Error())
+		return
+	}
+	opName, opType := operationInfo(op)
+
+	if opType == ast.OperationTypeSubscription {
+		h.metrics.ObserveGraphQL(opName, opType, 1)
+		h.sendRequestError(w, mediaType, http.StatusBadRequest, "Subscriptions are served over WebSocket with the graphql-transport-ws protocol")
+		return
+	}
+	if r.Method == http.MethodGet && opType != ast.OperationTypeQuery {
+		w.Header().Set("Allow", "POST")
+		h.metrics.ObserveGraphQL(opName, opType, 1)
+		h.sendRequestError(w, mediaType, http.StatusMethodNotAllowed, fmt.Sprintf("A %s must be sent with POST", opType))
+		return
+	}
+
+	if vr := graphql.ValidateDocument(&Schema, doc, nil); !vr.IsValid {
+		h.metrics.ObserveGraphQL(opName, opType, len(vr.Errors))
+		h.sendErrors(w, mediaType, vr.Errors, nil)
+		return
+	}
+
+	cost := measure(doc, op, req.Variables)
+	ext := h.limits.extensions(cost)
+	if errs := h.limits.check(cost); errs != nil {
+		h.metrics.ObserveGraphQL(opName, opType, len(errs))
+		h.sendErrors(w, mediaType, errs, ext)
+		return
+	}
+
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        Schema,
+		AST:           doc,
+		OperationName: opName,
+		Args:          req.Variables,
+		Context:       WithLoaders(r.Context()),
+	})
+	h.metrics.ObserveGraphQL(opName, opType, len(result.Errors))
+
+	if rejected(result) {
+		h.sendErrors(w, mediaType, result.Errors, ext)
+		return
+	}
+	result.Extensions = ext
+	send(w, mediaType, http.StatusOK, result)
+}
+
+// rejected tells a request refused before execution, such as one whose
+// variables do not coerce, from an executed one. No root field is non-null,
+// so an executed operation always has data.
+func rejected(result *graphql.Result) bool {
+	return result.Data == nil && result.HasErrors()
+}
+
+// sendErrors reports a document that failed to parse or validate, whose
+// variables were rejected, or that is too expensive to run, so was never
+// executed. Such a response is
+// 400 with application/graphql-response+json, but plain application/json
+// clients get 200 as the spec requires for them.
+func (h Handler) sendErrors(w http.ResponseWriter, mediaType string, errs []gqlerrors.FormattedError, ext map[string]interface{}) {
+	status := http.StatusBadRequest
+	if mediaType == jsonType {
+		status = http.StatusOK
+	}
+	send(w, mediaType, status, requestError{Errors: errs, Extensions: ext})
+}
+
+// sendRequestError reports a request that is not a GraphQL request at all,
+// with the same status for either media type.
+func (h Handler) sendRequestError(w http.ResponseWriter, mediaType string, status int, message string) {
+	send(w, mediaType, status, requestError{Errors: []gqlerrors.FormattedError{gqlerrors.NewFormattedError(message)}})
+}
+
+func send(w http.ResponseWriter, mediaType string, status int, body interface{}) {
+	w.Header().Set("Content-Type", mediaType+"; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// responseType picks the media type of the response from the Accept header.
+// A client that states no preference gets application/json.
+func responseType(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return jsonType, true
+	}
+	acceptsJSON := false
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || params["q"] == "0" {
+			continue
+		}
+		switch mediaType {
+		case graphQLResponseType:
+			return graphQLResponseType, true
+		case jsonType, "application/*", "*/*":
+			acceptsJSON = true
+		}
+	}
+	return jsonType, acceptsJSON
+}
@@ -0,0 +1,78 @@
+package graphql
+
+import (
+	"testing"
+
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+func TestSelectOperation(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		opName   string
+		want     string
+		wantType string
+		wantErr  bool
+	}{
+		{name: "only operation", query: `{ order(id: "1") { order_id } }`, wantType: "query"},
+		{name: "only operation by name", query: `query A { order(id: "1") { order_id } }`, opName: "A", want: "A", wantType: "query"},
+		{name: "named in several", query: `query A { order(id: "1") { order_id } } mutation B { deleteProduct(id: "1") { prod_id } }`, opName: "B", want: "B", wantType: "mutation"},
+		{name: "several without a name", query: `query A { order(id: "1") { order_id } } query B { order(id: "2") { order_id } }`, wantErr: true},
+		{name: "unknown name", query: `query A { order(id: "1") { order_id } }`, opName: "C", wantErr: true},
+		{name: "name of an anonymous operation", query: `{ order(id: "1") { order_id } }`, opName: "A", wantErr: true},
+		{name: "fragments only", query: `fragment F on Order { order_id }`, wantErr: true},
+		{name: "fragments are skipped", query: `fragment F on Order { order_id } subscription S { orderStatusChanged { ...F } }`, want: "S", wantType: "subscription"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parser.Parse(parser.ParseParams{Source: tt.query})
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			op, err := selectOperation(doc, tt.opName)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("selectOperation(%q) = %v, want an error", tt.opName, op)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("selectOperation(%q): %v", tt.opName, err)
+			}
+			if name, opType := operationInfo(op); name != tt.want || opType != tt.wantType {
+				t.Errorf("selected %s %q, want %s %q", opType, name, tt.wantType, tt.want)
+			}
+		})
+	}
+}
+
+func TestResponseType(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+		ok     bool
+	}{
+		{accept: "", want: jsonType, ok: true},
+		{accept: "application/json", want: jsonType, ok: true},
+		{accept: "application/graphql-response+json", want: graphQLResponseType, ok: true},
+		{accept: "application/json, application/graphql-response+json", want: graphQLResponseType, ok: true},
+		{accept: "application/graphql-response+json;q=0.9, application/json;q=0.8", want: graphQLResponseType, ok: true},
+		{accept: "application/graphql-response+json;q=0, application/json", want: jsonType, ok: true},
+		{accept: "application/json; charset=utf-8", want: jsonType, ok: true},
+		{accept: "*/*", want: jsonType, ok: true},
+		{accept: "application/*", want: jsonType, ok: true},
+		{accept: "text/html, */*;q=0.8", want: jsonType, ok: true},
+		{accept: "text/html", want: jsonType, ok: false},
+		{accept: "application/json;q=0", want: jsonType, ok: false},
+		{accept: "not a media type", want: jsonType, ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			got, ok := responseType(tt.accept)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("responseType(%q) = %q, %v, want %q, %v", tt.accept, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
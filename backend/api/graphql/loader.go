@@ -0,0 +1,150 @@
+package graphql
+
+import (
+	"context"
+	"sync"
+
+	"github.com/avnpl/go-march/models"
+	"github.com/avnpl/go-march/services"
+	"github.com/avnpl/go-march/utils"
+	"go.uber.org/zap"
+)
+
+type loadersKey struct{}
+
+// loaders holds the per-request DataLoaders. They are created on first use so
+// WithLoaders does not need to know the services.
+type loaders struct {
+	once    sync.Once
+	product *productLoader
+}
+
+// WithLoaders gives one GraphQL request its own DataLoaders. Loaded values are
+// cached for the request only, the next request sees fresh data.
+func WithLoaders(ctx context.Context) context.Context {
+	return context.WithValue(ctx, loadersKey{}, &loaders{})
+}
+
+// productLoader returns the request's product loader, or a fresh one for a
+// context that went without WithLoaders (batching then spans one field only).
+func (r *Resolver) productLoader(ctx context.Context) *productLoader {
+	l, ok := ctx.Value(loadersKey{}).(*loaders)
+	if !ok {
+		return newProductLoader(r.productService, r.currencyService, r.log)
+	}
+	l.once.Do(func() { l.product = newProductLoader(r.productService, r.currencyService, r.log) })
+	return l.product
+}
+
+// productKey is one product as asked for, priced in currency or, when that is
+// empty, in its own currency.
+type productKey struct {
+	id       string
+	currency string
+}
+
+type productResult struct {
+	product *models.Product
+	err     error
+}
+
+// productLoader batches product lookups. Load only queues the ID and returns a
+// thunk; graphql-go runs thunks after resolving every sibling field, so by the
+// time the first one runs all IDs of the list are queued and one
+// GetProductsByIDs call fetches them together, with one conversion per
+// requested currency.
+type productLoader struct {
+	svc        services.ProductService
+	currencies services.CurrencyService
+	log        *zap.Logger
+	mu         sync.Mutex
+	pending    []productKey
+	results    map[productKey]*productResult
+}
+
+func newProductLoader(svc services.ProductService, currencies services.CurrencyService, log *zap.Logger) *productLoader {
+	return &productLoader{svc: svc, currencies: currencies, log: log, results: make(map[productKey]*productResult)}
+}
+
+// Load queues one product. A failed batch is logged once by dispatch, so the
+// thunk returns the client-facing error without logging it again.
+func (l *productLoader) Load(ctx context.Context, id string, currency string) func() (interface{}, error) {
+	key := productKey{id: id, currency: currency}
+	l.mu.Lock()
+	if _, ok := l.results[key]; !ok {
+		l.results[key] = nil
+		l.pending = append(l.pending, key)
+	}
+	l.mu.Unlock()
+
+	return func() (interface{}, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.results[key] == nil {
+			l.dispatch(ctx)
+		}
+		res := l.results[key]
+		if res.err != nil {
+			return nil, res.err
+		}
+		if res.product == nil {
+			return nil, nil
+		}
+		return *res.product, nil
+	}
+}
+
+// dispatch fetches every queued ID, l.mu must be held.
+func (l *productLoader) dispatch(ctx context.Context) {
+	keys := l.pending
+	l.pending = nil
+
+	var ids []string
+	seen := make(map[string]bool)
+	byCurrency := make(map[string][]productKey)
+	for _, key := range keys {
+		if !seen[key.id] {
+			seen[key.id] = true
+			ids = append(ids, key.id)
+		}
+		byCurrency[key.currency] = append(byCurrency[key.currency], key)
+	}
+
+	products, err := l.svc.GetProductsByIDs(ctx, ids)
+	if err != nil {
+		utils.LoggerFrom(ctx, l.log).Error("product batch failed", zap.Int("ids", len(ids)), zap.Error(err))
+		l.fail(keys, err)
+		return
+	}
+	byID := make(map[string]models.Product, len(products))
+	for _, p := range products {
+		byID[p.ProductID] = p
+	}
+
+	for currency, keys := range byCurrency {
+		var found []models.Product
+		for _, key := range keys {
+			l.results[key] = &productResult{}
+			if p, ok := byID[key.id]; ok {
+				found = append(found, p)
+			}
+		}
+		if currency != "" && len(found) > 0 {
+			if err := l.currencies.ConvertProducts(ctx, found, currency); err != nil {
+				utils.LoggerFrom(ctx, l.log).Error("product batch conversion failed", zap.String("currency", currency), zap.Error(err))
+				l.fail(keys, err)
+				continue
+			}
+		}
+		for i := range found {
+			l.results[productKey{id: found[i].ProductID, currency: currency}].product = &found[i]
+		}
+	}
+}
+
+func (l *productLoader) fail(keys []productKey, err error) {
+	res := &productResult{err: clientError(err)}
+	for _, key := range keys {
+		l.results[key] = res
+	}
+}
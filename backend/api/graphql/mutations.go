@@ -6,6 +6,17 @@ import (
 
 func GetMutationFields(resolver *Resolver) graphql.Fields {
 	return graphql.Fields{
+		"createProduct": &graphql.Field{
+			Type: ProductType,
+			Args: graphql.FieldConfigArgument{
+				"input": &graphql.ArgumentConfig{
+					Type:        graphql.NewNonNull(CreateProductInput),
+					Description: "Input data for creating a product",
+				},
+			},
+			Resolve:     resolver.CreateProduct,
+			Description: "Create a new product",
+		},
 		"updateProduct": &graphql.Field{
 			Type: ProductType,
 			Args: graphql.FieldConfigArgument{
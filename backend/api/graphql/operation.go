@@ -0,0 +1,43 @@
+package graphql
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// selectOperation finds the operation to execute: the one named, or the only
+// one in the document.
+func selectOperation(doc *ast.Document, name string) (*ast.OperationDefinition, error) {
+	var found *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if name == "" {
+			if found != nil {
+				return nil, errors.New("operationName is required for a document with several operations")
+			}
+			found = op
+		} else if op.Name != nil && op.Name.Value == name {
+			return op, nil
+		}
+	}
+	if found == nil {
+		if name != "" {
+			return nil, fmt.Errorf("Unknown operation named %q", name)
+		}
+		return nil, errors.New("The document contains no operation")
+	}
+	return found, nil
+}
+
+func operationInfo(op *ast.OperationDefinition) (string, string) {
+	name := ""
+	if op.Name != nil {
+		name = op.Name.Value
+	}
+	return name, op.Operation
+}
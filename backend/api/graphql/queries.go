@@ -13,14 +13,54 @@ func GetQueryFields(resolver *Resolver) graphql.Fields {
 					Type:        graphql.NewNonNull(graphql.String),
 					Description: "The ID of the product to fetch",
 				},
+				"currency": currencyArg,
 			},
 			Resolve:     resolver.GetProductByID,
 			Description: "Fetch a single product by ID",
 		},
 		"getAllProducts": &graphql.Field{
 			Type:        graphql.NewList(ProductType),
+			Args:        productListArgs,
 			Resolve:     resolver.GetAllProducts,
-			Description: "Fetch all products",
+			Description: "Fetch a page of products",
+		},
+		"products": &graphql.Field{
+			Type:        ProductPageType,
+			Args:        productListArgs,
+			Resolve:     resolver.GetProductPage,
+			Description: "Fetch a page of products with the cursor to the next page",
+		},
+		"order": &graphql.Field{
+			Type: OrderType,
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type:        graphql.NewNonNull(graphql.String),
+					Description: "The ID of the order to fetch",
+				},
+				"currency": currencyArg,
+			},
+			Resolve:     resolver.GetOrderByID,
+			Description: "Fetch a single order by ID",
+		},
+		"orders": &graphql.Field{
+			Type: OrderPageType,
+			Args: graphql.FieldConfigArgument{
+				"status": &graphql.ArgumentConfig{
+					Type:        graphql.String,
+					Description: "Only orders in this status: pending, paid or failed",
+				},
+				"first": &graphql.ArgumentConfig{
+					Type:        graphql.Int,
+					Description: "Maximum number of orders to return (default 20, max 100)",
+				},
+				"after": &graphql.ArgumentConfig{
+					Type:        graphql.String,
+					Description: "The next_cursor of the previous page",
+				},
+				"currency": currencyArg,
+			},
+			Resolve:     resolver.GetOrderPage,
+			Description: "Fetch a page of orders, newest first",
 		},
 	}
 }
@@ -3,26 +3,55 @@ package graphql
 import (
 	"context"
 
+	"github.com/avnpl/go-march/events"
 	"github.com/avnpl/go-march/models"
+	"github.com/avnpl/go-march/money"
 	"github.com/avnpl/go-march/services"
+	"github.com/avnpl/go-march/utils"
+	"github.com/go-playground/validator/v10"
 	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"go.uber.org/zap"
 )
 
 type Resolver struct {
-	productService services.ProductService
+	productService  services.ProductService
+	orderService    services.OrderService
+	currencyService services.CurrencyService
+	bus             *events.Bus
+	log             *zap.Logger
+	validate        *validator.Validate
 }
 
-func NewResolver(productService services.ProductService) *Resolver {
+func NewResolver(productService services.ProductService, orderService services.OrderService, currencyService services.CurrencyService, bus *events.Bus, log *zap.Logger, validate *validator.Validate) *Resolver {
 	return &Resolver{
-		productService: productService,
+		productService:  productService,
+		orderService:    orderService,
+		currencyService: currencyService,
+		bus:             bus,
+		log:             log,
+		validate:        validate,
 	}
 }
 
+// logError records a failed resolver on the request-scoped logger together
+// with the field and operation it belongs to.
+func (r *Resolver) logError(p graphql.ResolveParams, err error) {
+	fields := []zap.Field{zap.String("field", p.Info.FieldName), zap.Error(err)}
+	if op, ok := p.Info.Operation.(*ast.OperationDefinition); ok {
+		fields = append(fields, zap.String("operation_type", op.Operation))
+		if op.Name != nil {
+			fields = append(fields, zap.String("operation", op.Name.Value))
+		}
+	}
+	utils.LoggerFrom(p.Context, r.log).Error("resolver failed", fields...)
+}
+
 func (r *Resolver) GetProductByID(p graphql.ResolveParams) (interface{}, error) {
 
 	idStr, ok := p.Args["id"].(string)
 	if !ok {
-		return nil, nil
+		return nil, r.fail(p, utils.InField("id", utils.ErrInvalidRequest))
 	}
 
 	ctx := p.Context
@@ -32,8 +61,13 @@ func (r *Resolver) GetProductByID(p graphql.ResolveParams) (interface{}, error)
 
 	product, err := r.productService.GetProductByID(ctx, idStr)
 	if err != nil {
-		return nil, err
+		return nil, r.fail(p, err)
 	}
+	products := []models.Product{product}
+	if err := r.convertProducts(ctx, p.Args, products); err != nil {
+		return nil, r.fail(p, err)
+	}
+	product = products[0]
 
 	return product, nil
 }
@@ -45,39 +79,234 @@ func (r *Resolver) GetAllProducts(p graphql.ResolveParams) (interface{}, error)
 		ctx = context.Background()
 	}
 
-	products, err := r.productService.GetAllProducts(ctx)
+	opts, err := productListOpts(p.Args)
+	if err != nil {
+		return nil, r.fail(p, err)
+	}
+	page, err := r.productService.GetAllProducts(ctx, opts)
 	if err != nil {
-		return nil, err
+		return nil, r.fail(p, err)
+	}
+	if err := r.convertProducts(ctx, p.Args, page.Products); err != nil {
+		return nil, r.fail(p, err)
 	}
 
-	return products, nil
+	return page.Products, nil
 }
 
-func (r *Resolver) UpdateProduct(p graphql.ResolveParams) (interface{}, error) {
-	input, ok := p.Args["input"].(map[string]interface{})
+func (r *Resolver) GetProductPage(p graphql.ResolveParams) (interface{}, error) {
+
+	ctx := p.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	opts, err := productListOpts(p.Args)
+	if err != nil {
+		return nil, r.fail(p, err)
+	}
+	page, err := r.productService.GetAllProducts(ctx, opts)
+	if err != nil {
+		return nil, r.fail(p, err)
+	}
+	if err := r.convertProducts(ctx, p.Args, page.Products); err != nil {
+		return nil, r.fail(p, err)
+	}
+
+	return page, nil
+}
+
+// convertProducts re-prices products into the currency argument, if given.
+func (r *Resolver) convertProducts(ctx context.Context, args map[string]interface{}, products []models.Product) error {
+	currency, ok := args["currency"].(string)
+	if !ok || currency == "" {
+		return nil
+	}
+	return r.currencyService.ConvertProducts(ctx, products, currency)
+}
+
+func (r *Resolver) GetOrderByID(p graphql.ResolveParams) (interface{}, error) {
+
+	idStr, ok := p.Args["id"].(string)
 	if !ok {
-		return nil, nil
+		return nil, r.fail(p, utils.InField("id", utils.ErrInvalidRequest))
 	}
 
-	prodID, ok := input["prod_id"].(string)
+	ctx := p.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	order, err := r.orderService.GetOrderByID(ctx, idStr)
+	if err != nil {
+		return nil, r.fail(p, err)
+	}
+	orders := []models.Orders{order}
+	if err := r.convertOrders(ctx, p.Args, orders); err != nil {
+		return nil, r.fail(p, err)
+	}
+
+	return orders[0], nil
+}
+
+func (r *Resolver) GetOrderPage(p graphql.ResolveParams) (interface{}, error) {
+
+	ctx := p.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var opts models.OrderListOpts
+	if first, ok := p.Args["first"].(int); ok {
+		opts.Limit = first
+	}
+	if after, ok := p.Args["after"].(string); ok {
+		opts.Cursor = after
+	}
+	if status, ok := p.Args["status"].(string); ok {
+		opts.Status = status
+	}
+
+	page, err := r.orderService.GetOrderPage(ctx, opts)
+	if err != nil {
+		return nil, r.fail(p, err)
+	}
+	if err := r.convertOrders(ctx, p.Args, page.Orders); err != nil {
+		return nil, r.fail(p, err)
+	}
+
+	return page, nil
+}
+
+// OrderProduct resolves Order.product through the request's product loader,
+// so a page of orders costs one product query instead of one per order, and
+// one conversion per currency.
+func (r *Resolver) OrderProduct(p graphql.ResolveParams) (interface{}, error) {
+	order, ok := p.Source.(models.Orders)
 	if !ok {
 		return nil, nil
 	}
 
+	ctx := p.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	currency, _ := p.Args["currency"].(string)
+	return r.productLoader(ctx).Load(ctx, order.ProductID, currency), nil
+}
+
+// convertOrders converts order totals into the currency argument, if given.
+func (r *Resolver) convertOrders(ctx context.Context, args map[string]interface{}, orders []models.Orders) error {
+	currency, ok := args["currency"].(string)
+	if !ok || currency == "" {
+		return nil
+	}
+	return r.currencyService.ConvertOrders(ctx, orders, currency)
+}
+
+func productListOpts(args map[string]interface{}) (models.ProductListOpts, error) {
+	var opts models.ProductListOpts
+
+	if limit, ok := args["limit"].(int); ok {
+		opts.Limit = limit
+	}
+	if cursor, ok := args["cursor"].(string); ok {
+		opts.Cursor = cursor
+	}
+	if sort, ok := args["sort"].(string); ok {
+		opts.Sort = sort
+	}
+	for field, dst := range map[string]**money.Amount{"min_price": &opts.MinPrice, "max_price": &opts.MaxPrice} {
+		price, ok, err := moneyArg(args, field)
+		if err != nil {
+			return opts, err
+		}
+		if ok {
+			*dst = &price
+		}
+	}
+	if inStock, ok := args["in_stock"].(bool); ok {
+		opts.InStock = &inStock
+	}
+	if name, ok := args["name_contains"].(string); ok {
+		opts.NameContains = name
+	}
+	if currency, ok := args["price_currency"].(string); ok {
+		opts.PriceCurrency = currency
+	}
+	return opts, nil
+}
+
+func (r *Resolver) CreateProduct(p graphql.ResolveParams) (interface{}, error) {
+	input, ok := p.Args["input"].(map[string]interface{})
+	if !ok {
+		return nil, r.fail(p, utils.InField("input", utils.ErrInvalidRequest))
+	}
+
+	var req models.CreateProductReq
+	if name, ok := input["name"].(string); ok {
+		req.Name = name
+	}
+	price, _, err := moneyArg(input, "price")
+	if err != nil {
+		return nil, r.fail(p, err)
+	}
+	req.Price = price
+	if stock, ok := input["stock"].(int); ok {
+		req.Stock = stock
+	}
+	if currency, ok := input["currency"].(string); ok {
+		req.Currency = currency
+	}
+
+	if err := r.validate.Struct(req); err != nil {
+		return nil, r.fail(p, utils.NewValidationError(err))
+	}
+
+	ctx := p.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	product, err := r.productService.CreateProduct(ctx, &req)
+	if err != nil {
+		return nil, r.fail(p, err)
+	}
+
+	return product, nil
+}
+
+func (r *Resolver) UpdateProduct(p graphql.ResolveParams) (interface{}, error) {
+	input, ok := p.Args["input"].(map[string]interface{})
+	if !ok {
+		return nil, r.fail(p, utils.InField("input", utils.ErrInvalidRequest))
+	}
+
+	prodID, _ := input["prod_id"].(string)
 	req := &models.UpdateProductReq{
 		ProductID: prodID,
 	}
 
-	if name, ok := input["name"].(string); ok && name != "" {
-		req.Name = name
+	// Fields left out of the input, or given as null, are not changed.
+	if name, ok := input["name"].(string); ok {
+		req.Name = &name
 	}
 
-	if price, ok := input["price"].(float64); ok {
-		req.Price = price
+	price, ok, err := moneyArg(input, "price")
+	if err != nil {
+		return nil, r.fail(p, err)
+	}
+	if ok {
+		req.Price = &price
 	}
 
 	if stock, ok := input["stock"].(int); ok {
-		req.Stock = stock
+		req.Stock = &stock
+	}
+
+	if err := r.validate.Struct(req); err != nil {
+		return nil, r.fail(p, utils.NewValidationError(err))
 	}
 
 	ctx := p.Context
@@ -87,7 +316,7 @@ func (r *Resolver) UpdateProduct(p graphql.ResolveParams) (interface{}, error) {
 
 	product, err := r.productService.UpdateProduct(ctx, req)
 	if err != nil {
-		return nil, err
+		return nil, r.fail(p, err)
 	}
 
 	return product, nil
@@ -102,17 +331,17 @@ func (r *Resolver) DeleteProduct(p graphql.ResolveParams) (interface{}, error) {
 
 	input, ok := p.Args["input"].(map[string]interface{})
 	if !ok {
-		return nil, nil
+		return nil, r.fail(p, utils.InField("input", utils.ErrInvalidRequest))
 	}
 
 	productID, ok := input["prod_id"].(string)
-	if !ok {
-		return nil, nil
+	if !ok || productID == "" {
+		return nil, r.fail(p, utils.InField("prod_id", utils.ErrInvalidRequest))
 	}
 
 	product, err := r.productService.DeleteProduct(ctx, productID)
 	if err != nil {
-		return nil, err
+		return nil, r.fail(p, err)
 	}
 
 	return product, nil
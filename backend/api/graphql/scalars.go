@@ -0,0 +1,82 @@
+package graphql
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/avnpl/go-march/money"
+	"github.com/avnpl/go-march/utils"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// MoneyScalar carries exact two-place decimals. It is written out as a string
+// ("149.97") so no client parses it into a float, and read from strings or
+// number literals. Input is handed to resolvers as a moneyInput, which they
+// parse with moneyArg, so an amount with more than two decimal places is
+// reported as a validation error on its field.
+var MoneyScalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "Money",
+	Description: "An exact decimal amount with two decimal places, serialized as a string such as \"149.97\"",
+	Serialize: func(value interface{}) interface{} {
+		switch v := value.(type) {
+		case money.Amount:
+			return v.String()
+		case *money.Amount:
+			if v == nil {
+				return nil
+			}
+			return v.String()
+		default:
+			return nil
+		}
+	},
+	ParseValue: func(value interface{}) interface{} {
+		switch v := value.(type) {
+		case string:
+			return moneyInput(v)
+		case float64:
+			return moneyInput(strconv.FormatFloat(v, 'f', -1, 64))
+		case int:
+			return moneyInput(strconv.Itoa(v))
+		default:
+			return nil
+		}
+	},
+	ParseLiteral: func(valueAST ast.Value) interface{} {
+		switch v := valueAST.(type) {
+		case *ast.StringValue:
+			return moneyInput(v.Value)
+		case *ast.FloatValue:
+			return moneyInput(v.Value)
+		case *ast.IntValue:
+			return moneyInput(v.Value)
+		default:
+			return nil
+		}
+	},
+})
+
+// moneyInput is a Money argument as the client wrote it.
+type moneyInput string
+
+// moneyArg parses the Money argument field of args. ok is false when the
+// argument was not given.
+func moneyArg(args map[string]interface{}, field string) (amount money.Amount, ok bool, err error) {
+	raw, ok := args[field].(moneyInput)
+	if !ok {
+		return 0, false, nil
+	}
+	amount, err = money.Parse(string(raw))
+	if err == nil {
+		return amount, true, nil
+	}
+
+	v := utils.Violation{Field: field, Rule: "decimal", Message: fmt.Sprintf("%s must be a decimal number", field)}
+	if errors.Is(err, money.ErrTooPrecise) {
+		v.Rule = "scale"
+		v.Message = fmt.Sprintf("%s must have at most %d decimal places", field, money.Scale)
+	}
+	return 0, true, &utils.ValidationError{Violations: []utils.Violation{v}}
+}
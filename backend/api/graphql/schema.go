@@ -1,18 +1,29 @@
 package graphql
 
 import (
+	"github.com/avnpl/go-march/events"
 	"github.com/avnpl/go-march/services"
+	"github.com/go-playground/validator/v10"
 	"github.com/graphql-go/graphql"
+	"go.uber.org/zap"
 )
 
 var (
-	QueryType    *graphql.Object
-	MutationType *graphql.Object
-	Schema       graphql.Schema
+	QueryType        *graphql.Object
+	MutationType     *graphql.Object
+	SubscriptionType *graphql.Object
+	Schema           graphql.Schema
 )
 
-func NewSchema(productService services.ProductService) error {
-	resolver := NewResolver(productService)
+func NewSchema(productService services.ProductService, orderService services.OrderService, currencyService services.CurrencyService, bus *events.Bus, logger *zap.Logger, validate *validator.Validate) error {
+	resolver := NewResolver(productService, orderService, currencyService, bus, logger, validate)
+
+	OrderType.AddFieldConfig("product", &graphql.Field{
+		Type:        ProductType,
+		Args:        graphql.FieldConfigArgument{"currency": currencyArg},
+		Resolve:     resolver.OrderProduct,
+		Description: "The ordered product, loaded in one batch for all orders of a request",
+	})
 
 	QueryType = graphql.NewObject(graphql.ObjectConfig{
 		Name:   "Query",
@@ -24,10 +35,16 @@ func NewSchema(productService services.ProductService) error {
 		Fields: GetMutationFields(resolver),
 	})
 
+	SubscriptionType = graphql.NewObject(graphql.ObjectConfig{
+		Name:   "Subscription",
+		Fields: GetSubscriptionFields(resolver),
+	})
+
 	var err error
 	Schema, err = graphql.NewSchema(graphql.SchemaConfig{
-		Query:    QueryType,
-		Mutation: MutationType,
+		Query:        QueryType,
+		Mutation:     MutationType,
+		Subscription: SubscriptionType,
 	})
 
 	return err
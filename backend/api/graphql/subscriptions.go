@@ -0,0 +1,118 @@
+package graphql
+
+import (
+	"context"
+
+	"github.com/avnpl/go-march/events"
+	"github.com/graphql-go/graphql"
+)
+
+func GetSubscriptionFields(resolver *Resolver) graphql.Fields {
+	return graphql.Fields{
+		"productUpdated": &graphql.Field{
+			Type: ProductType,
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type:        graphql.String,
+					Description: "Only this product (default all products)",
+				},
+			},
+			Subscribe:   resolver.SubscribeProductUpdated,
+			Resolve:     eventProduct,
+			Description: "A product after every update, including stock taken by orders",
+		},
+		"stockChanged": &graphql.Field{
+			Type: ProductType,
+			Args: graphql.FieldConfigArgument{
+				"threshold": &graphql.ArgumentConfig{
+					Type:        graphql.Int,
+					Description: "Only when the new stock is at or below this (default any stock)",
+				},
+			},
+			Subscribe:   resolver.SubscribeStockChanged,
+			Resolve:     eventProduct,
+			Description: "A product whenever its stock changes",
+		},
+		"orderStatusChanged": &graphql.Field{
+			Type: OrderType,
+			Args: graphql.FieldConfigArgument{
+				"order_id": &graphql.ArgumentConfig{
+					Type:        graphql.String,
+					Description: "Only this order (default all orders)",
+				},
+			},
+			Subscribe:   resolver.SubscribeOrderStatusChanged,
+			Resolve:     eventOrder,
+			Description: "An order whenever a payment moves it to paid or failed",
+		},
+	}
+}
+
+func (r *Resolver) SubscribeProductUpdated(p graphql.ResolveParams) (interface{}, error) {
+	id, _ := p.Args["id"].(string)
+	return r.subscribe(p.Context, func(e events.Event) bool {
+		return e.Topic == events.ProductUpdated && (id == "" || e.Product.ProductID == id)
+	}), nil
+}
+
+func (r *Resolver) SubscribeStockChanged(p graphql.ResolveParams) (interface{}, error) {
+	threshold, limited := p.Args["threshold"].(int)
+	return r.subscribe(p.Context, func(e events.Event) bool {
+		return e.Topic == events.StockChanged && (!limited || e.Product.Stock <= threshold)
+	}), nil
+}
+
+func (r *Resolver) SubscribeOrderStatusChanged(p graphql.ResolveParams) (interface{}, error) {
+	id, _ := p.Args["order_id"].(string)
+	return r.subscribe(p.Context, func(e events.Event) bool {
+		return e.Topic == events.OrderStatusChanged && (id == "" || e.Order.OrderID == id)
+	}), nil
+}
+
+// subscribe forwards the bus events that keep accepts until ctx, the life of
+// the subscription, ends.
+func (r *Resolver) subscribe(ctx context.Context, keep func(events.Event) bool) chan interface{} {
+	in, unsubscribe := r.bus.Subscribe()
+	out := make(chan interface{})
+	go func() {
+		defer close(out)
+		defer unsubscribe()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e, ok := <-in:
+				if !ok {
+					return
+				}
+				if !keep(e) {
+					continue
+				}
+				select {
+				case out <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// eventProduct and eventOrder resolve a subscription field from the event the
+// subscription delivered.
+func eventProduct(p graphql.ResolveParams) (interface{}, error) {
+	e, ok := p.Source.(events.Event)
+	if !ok {
+		return nil, nil
+	}
+	return e.Product, nil
+}
+
+func eventOrder(p graphql.ResolveParams) (interface{}, error) {
+	e, ok := p.Source.(events.Event)
+	if !ok {
+		return nil, nil
+	}
+	return e.Order, nil
+}
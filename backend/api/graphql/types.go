@@ -9,13 +9,110 @@ var ProductType = graphql.NewObject(graphql.ObjectConfig{
 	Fields: graphql.Fields{
 		"prod_id":    &graphql.Field{Type: graphql.String},
 		"prod_name":  &graphql.Field{Type: graphql.String},
-		"price":      &graphql.Field{Type: graphql.Float},
+		"price":      &graphql.Field{Type: MoneyScalar},
+		"currency":   &graphql.Field{Type: graphql.String},
 		"stock":      &graphql.Field{Type: graphql.Int},
 		"created_at": &graphql.Field{Type: graphql.String},
 		"updated_at": &graphql.Field{Type: graphql.String},
 	},
 })
 
+var ProductPageType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ProductPage",
+	Fields: graphql.Fields{
+		"products":    &graphql.Field{Type: graphql.NewList(ProductType)},
+		"next_cursor": &graphql.Field{Type: graphql.String},
+		"total_count": &graphql.Field{Type: graphql.Int},
+	},
+})
+
+// OrderType gets its product field from NewSchema, which has the resolver.
+var OrderType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Order",
+	Fields: graphql.Fields{
+		"order_id":         &graphql.Field{Type: graphql.String},
+		"product_id":       &graphql.Field{Type: graphql.String},
+		"quantity":         &graphql.Field{Type: graphql.Int},
+		"total_price":      &graphql.Field{Type: MoneyScalar},
+		"currency":         &graphql.Field{Type: graphql.String},
+		"order_time":       &graphql.Field{Type: graphql.String},
+		"status":           &graphql.Field{Type: graphql.String},
+		"shipping_address": &graphql.Field{Type: graphql.String},
+		"notes":            &graphql.Field{Type: graphql.String},
+	},
+})
+
+var OrderPageType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "OrderPage",
+	Fields: graphql.Fields{
+		"orders":      &graphql.Field{Type: graphql.NewList(OrderType)},
+		"next_cursor": &graphql.Field{Type: graphql.String},
+	},
+})
+
+var currencyArg = &graphql.ArgumentConfig{
+	Type:        graphql.String,
+	Description: "ISO 4217 code to convert prices into, using the stored exchange rates",
+}
+
+var productListArgs = graphql.FieldConfigArgument{
+	"limit": &graphql.ArgumentConfig{
+		Type:        graphql.Int,
+		Description: "Maximum number of products to return (default 20, max 100)",
+	},
+	"cursor": &graphql.ArgumentConfig{
+		Type:        graphql.String,
+		Description: "The next_cursor of the previous page",
+	},
+	"sort": &graphql.ArgumentConfig{
+		Type:        graphql.String,
+		Description: "One of price, name, created_at; prefix with - to sort descending. Sorting by price needs price_currency",
+	},
+	"min_price": &graphql.ArgumentConfig{
+		Type:        MoneyScalar,
+		Description: "Only products priced at or above this value in price_currency",
+	},
+	"max_price": &graphql.ArgumentConfig{
+		Type:        MoneyScalar,
+		Description: "Only products priced at or below this value in price_currency",
+	},
+	"price_currency": &graphql.ArgumentConfig{
+		Type:        graphql.String,
+		Description: "Only products priced in this ISO 4217 code; required with min_price, max_price or sorting by price",
+	},
+	"in_stock": &graphql.ArgumentConfig{
+		Type:        graphql.Boolean,
+		Description: "Only products that are (true) or are not (false) in stock",
+	},
+	"name_contains": &graphql.ArgumentConfig{
+		Type:        graphql.String,
+		Description: "Case-insensitive substring of the product name",
+	},
+	"currency": currencyArg,
+}
+
+var CreateProductInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "CreateProductInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"name": &graphql.InputObjectFieldConfig{
+			Type:        graphql.NewNonNull(graphql.String),
+			Description: "The name of the product",
+		},
+		"price": &graphql.InputObjectFieldConfig{
+			Type:        graphql.NewNonNull(MoneyScalar),
+			Description: "The price of the product, greater than 0",
+		},
+		"stock": &graphql.InputObjectFieldConfig{
+			Type:        graphql.Int,
+			Description: "The stock quantity, 0 or more (default 0)",
+		},
+		"currency": &graphql.InputObjectFieldConfig{
+			Type:        graphql.String,
+			Description: "ISO 4217 code of the price (default USD)",
+		},
+	},
+})
+
 var UpdateProductInput = graphql.NewInputObject(graphql.InputObjectConfig{
 	Name: "UpdateProductInput",
 	Fields: graphql.InputObjectConfigFieldMap{
@@ -28,7 +125,7 @@ var UpdateProductInput = graphql.NewInputObject(graphql.InputObjectConfig{
 			Description: "The new name of the product (optional)",
 		},
 		"price": &graphql.InputObjectFieldConfig{
-			Type:        graphql.Float,
+			Type:        MoneyScalar,
 			Description: "The new price of the product (optional)",
 		},
 		"stock": &graphql.InputObjectFieldConfig{
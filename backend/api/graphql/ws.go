@@ -0,0 +1,356 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/avnpl/go-march/utils"
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"go.uber.org/zap"
+)
+
+// The graphql-transport-ws protocol, see
+// https://github.com/enisdenjo/graphql-ws/blob/master/PROTOCOL.md
+const (
+	wsProtocol    = "graphql-transport-ws"
+	wsInitTimeout = 10 * time.Second
+	wsWriteWait   = 10 * time.Second
+
+	msgConnectionInit = "connection_init"
+	msgConnectionAck  = "connection_ack"
+	msgPing           = "ping"
+	msgPong           = "pong"
+	msgSubscribe      = "subscribe"
+	msgNext           = "next"
+	msgError          = "error"
+	msgComplete       = "complete"
+)
+
+// Close codes of the protocol.
+const (
+	closeBadRequest       = 4400
+	closeUnauthorized     = 4401
+	closeBadSubprotocol   = 4406
+	closeInitTimeout      = 4408
+	closeDuplicateID      = 4409
+	closeTooManyInitCalls = 4429
+)
+
+var upgrader = websocket.Upgrader{Subprotocols: []string{wsProtocol}}
+
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// wsConns tracks the open sockets so shutdown can close them, the HTTP
+// server lets go of a connection once it is upgraded.
+type wsConns struct {
+	mu    sync.Mutex
+	conns map[*wsConn]struct{}
+}
+
+// CloseSubscriptions tells every subscriber the server is going away.
+func (h Handler) CloseSubscriptions() {
+	h.sockets.mu.Lock()
+	defer h.sockets.mu.Unlock()
+	for c := range h.sockets.conns {
+		c.close(websocket.CloseGoingAway, "Server shutting down")
+	}
+}
+
+type wsConn struct {
+	h    Handler
+	ws   *websocket.Conn
+	ctx  context.Context
+	log  *zap.Logger
+	wmu  sync.Mutex
+	mu   sync.Mutex
+	ack  bool
+	init bool
+	ops  map[string]*wsOperation
+}
+
+// wsOperation is one running subscribe message. Ids are reused once complete,
+// so cleanup checks it still owns its id.
+type wsOperation struct {
+	cancel context.CancelFunc
+}
+
+func (h Handler) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has answered the request already.
+		return
+	}
+
+	// Messages are bounded like HTTP request bodies; a larger one closes the
+	// socket with 1009.
+	ws.SetReadLimit(h.maxBodyBytes)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	c := &wsConn{h: h, ws: ws, ctx: ctx, log: utils.LoggerFrom(r.Context(), h.log), ops: make(map[string]*wsOperation)}
+	defer ws.Close()
+
+	if ws.Subprotocol() != wsProtocol {
+		c.close(closeBadSubprotocol, "Subprotocol not acceptable")
+		return
+	}
+
+	h.sockets.mu.Lock()
+	h.sockets.conns[c] = struct{}{}
+	h.sockets.mu.Unlock()
+	defer func() {
+		h.sockets.mu.Lock()
+		delete(h.sockets.conns, c)
+		h.sockets.mu.Unlock()
+	}()
+
+	timer := time.AfterFunc(wsInitTimeout, func() {
+		c.mu.Lock()
+		ack := c.ack
+		c.mu.Unlock()
+		if !ack {
+			c.close(closeInitTimeout, "Connection initialisation timeout")
+		}
+	})
+	defer timer.Stop()
+
+	c.read()
+}
+
+// read handles client messages until the socket closes, then ends every
+// operation of the connection.
+func (c *wsConn) read() {
+	defer func() {
+		c.mu.Lock()
+		for _, op := range c.ops {
+			op.cancel()
+		}
+		c.mu.Unlock()
+	}()
+
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg wsMessage
+		if err := json.Unmarshal(data, &msg); err != nil || msg.Type == "" {
+			c.close(closeBadRequest, "Invalid message received")
+			return
+		}
+
+		switch msg.Type {
+		case msgConnectionInit:
+			c.mu.Lock()
+			again := c.init
+			c.init, c.ack = true, true
+			c.mu.Unlock()
+			if again {
+				c.close(closeTooManyInitCalls, "Too many initialisation requests")
+				return
+			}
+			c.send(wsMessage{Type: msgConnectionAck})
+		case msgPing:
+			c.send(wsMessage{Type: msgPong})
+		case msgPong:
+		case msgSubscribe:
+			if !c.start(msg) {
+				return
+			}
+		case msgComplete:
+			c.mu.Lock()
+			if op, ok := c.ops[msg.ID]; ok {
+				c.end(msg.ID, op)
+			}
+			c.mu.Unlock()
+		default:
+			c.close(closeBadRequest, fmt.Sprintf("Unknown message type %q", msg.Type))
+			return
+		}
+	}
+}
+
+// start runs one operation of a subscribe message. It returns false when the
+// connection had to be closed.
+func (c *wsConn) start(msg wsMessage) bool {
+	var req request
+	if msg.ID == "" || json.Unmarshal(msg.Payload, &req) != nil {
+		c.close(closeBadRequest, "Invalid subscribe message")
+		return false
+	}
+
+	c.mu.Lock()
+	if !c.ack {
+		c.mu.Unlock()
+		c.close(closeUnauthorized, "Unauthorized")
+		return false
+	}
+	if _, ok := c.ops[msg.ID]; ok {
+		c.mu.Unlock()
+		c.close(closeDuplicateID, fmt.Sprintf("Subscriber for %s already exists", msg.ID))
+		return false
+	}
+	if len(c.ops) >= c.h.maxOps {
+		c.mu.Unlock()
+		err := gqlerrors.NewFormattedError(fmt.Sprintf("A connection may run at most %d operations at once", c.h.maxOps))
+		err.Extensions = map[string]interface{}{"code": "TOO_MANY_SUBSCRIPTIONS"}
+		c.send(errorMessage(msg.ID, []gqlerrors.FormattedError{err}))
+		return true
+	}
+	ctx, cancel := context.WithCancel(c.ctx)
+	running := &wsOperation{cancel: cancel}
+	c.ops[msg.ID] = running
+	c.mu.Unlock()
+
+	doc, op, ext, errs := c.prepare(req)
+	if errs != nil {
+		c.finish(msg.ID, running)
+		c.send(errorMessage(msg.ID, errs))
+		return true
+	}
+	opName, opType := operationInfo(op)
+
+	go func() {
+		defer c.finish(msg.ID, running)
+
+		params := graphql.ExecuteParams{
+			Schema:        Schema,
+			AST:           doc,
+			OperationName: opName,
+			Args:          req.Variables,
+			Context:       ctx,
+		}
+		if opType != ast.OperationTypeSubscription {
+			params.Context = WithLoaders(ctx)
+			result := graphql.Execute(params)
+			result.Extensions = ext
+			c.h.metrics.ObserveGraphQL(opName, opType, len(result.Errors))
+			if rejected(result) {
+				c.fail(ctx, msg.ID, running, result.Errors)
+				return
+			}
+			c.next(ctx, msg.ID, result)
+			c.complete(ctx, msg.ID, running)
+			return
+		}
+
+		c.h.metrics.ObserveGraphQL(opName, opType, 0)
+		// Every event executes the whole document again, so product and order
+		// fields are loaded fresh each time.
+		for result := range graphql.ExecuteSubscription(params) {
+			if rejected(result) {
+				// Ending the operation stops the subscription; the channel is
+				// still drained so its goroutine can exit.
+				c.fail(ctx, msg.ID, running, result.Errors)
+				continue
+			}
+			result.Extensions = ext
+			c.next(ctx, msg.ID, result)
+		}
+		c.complete(ctx, msg.ID, running)
+	}()
+	return true
+}
+
+// prepare parses, validates and prices a subscribe payload.
+func (c *wsConn) prepare(req request) (*ast.Document, *ast.OperationDefinition, map[string]interface{}, []gqlerrors.FormattedError) {
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{
+		Body: []byte(req.Query),
+		Name: "GraphQL request",
+	})})
+	if err != nil {
+		return nil, nil, nil, gqlerrors.FormatErrors(err)
+	}
+	op, err := selectOperation(doc, req.OperationName)
+	if err != nil {
+		return nil, nil, nil, gqlerrors.FormatErrors(err)
+	}
+	if vr := graphql.ValidateDocument(&Schema, doc, nil); !vr.IsValid {
+		return nil, nil, nil, vr.Errors
+	}
+	if op.Operation == ast.OperationTypeSubscription && len(op.SelectionSet.Selections) != 1 {
+		return nil, nil, nil, []gqlerrors.FormattedError{gqlerrors.NewFormattedError("A subscription must select exactly one top level field")}
+	}
+	cost := measure(doc, op, req.Variables)
+	if errs := c.h.limits.check(cost); errs != nil {
+		return nil, nil, nil, errs
+	}
+	return doc, op, c.h.limits.extensions(cost), nil
+}
+
+// next and complete send nothing once the client completed the operation.
+func (c *wsConn) next(ctx context.Context, id string, result *graphql.Result) {
+	if ctx.Err() != nil {
+		return
+	}
+	payload, _ := json.Marshal(result)
+	c.send(wsMessage{ID: id, Type: msgNext, Payload: payload})
+}
+
+func (c *wsConn) complete(ctx context.Context, id string, op *wsOperation) {
+	if ctx.Err() != nil {
+		return
+	}
+	// Free the id before the client hears about it, it may reuse it at once.
+	c.finish(id, op)
+	c.send(wsMessage{ID: id, Type: msgComplete})
+}
+
+// fail ends the operation with an error message, which like complete is the
+// last the client hears of it.
+func (c *wsConn) fail(ctx context.Context, id string, op *wsOperation, errs []gqlerrors.FormattedError) {
+	if ctx.Err() != nil {
+		return
+	}
+	c.finish(id, op)
+	c.send(errorMessage(id, errs))
+}
+
+func (c *wsConn) finish(id string, op *wsOperation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.end(id, op)
+}
+
+// end cancels op and frees its id if op still holds it. c.mu must be held.
+func (c *wsConn) end(id string, op *wsOperation) {
+	op.cancel()
+	if c.ops[id] == op {
+		delete(c.ops, id)
+	}
+}
+
+func errorMessage(id string, errs []gqlerrors.FormattedError) wsMessage {
+	payload, _ := json.Marshal(errs)
+	return wsMessage{ID: id, Type: msgError, Payload: payload}
+}
+
+func (c *wsConn) send(msg wsMessage) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_ = c.ws.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	if err := c.ws.WriteJSON(msg); err != nil {
+		c.log.Debug("websocket write failed", zap.Error(err))
+		c.ws.Close()
+	}
+}
+
+func (c *wsConn) close(code int, reason string) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_ = c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(wsWriteWait))
+	c.ws.Close()
+}
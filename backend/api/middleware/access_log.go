@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/avnpl/go-march/utils"
+	"go.uber.org/zap"
+)
+
+// AccessLog writes one line per request. The route pattern is filled in by the
+// ServeMux on the request it is handed, so nothing between this middleware
+// and the mux may replace the *http.Request.
+func AccessLog(logger *zap.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := newResponseRecorder(w)
+
+			defer func() {
+				route := r.Pattern
+				if route == "" {
+					route = "unmatched"
+				}
+				fields := []zap.Field{
+					zap.String("method", r.Method),
+					zap.String("route", route),
+					zap.String("path", r.URL.Path),
+					zap.Int("status", rec.Status()),
+					zap.Int("bytes", rec.bytes),
+					zap.Duration("latency", time.Since(start)),
+					zap.String("client_ip", clientIP(r)),
+				}
+				if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+					fields = append(fields, zap.String("forwarded_for", fwd))
+				}
+				utils.LoggerFrom(r.Context(), logger).Info("request", fields...)
+			}()
+
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
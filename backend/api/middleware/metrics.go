@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/avnpl/go-march/metrics"
+)
+
+// Metrics records request count and latency per route pattern and status.
+// Like AccessLog it relies on the mux setting the pattern on the same request.
+func Metrics(m *metrics.Metrics) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := newResponseRecorder(w)
+
+			defer func() {
+				route := r.Pattern
+				if route == "" {
+					route = "unmatched"
+				}
+				m.ObserveHTTP(r.Method, route, rec.Status(), time.Since(start))
+			}()
+
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"github.com/avnpl/go-march/utils"
+	"go.uber.org/zap"
+)
+
+// Recover turns a panic in a handler into the standard 500 JSON error and logs
+// it with the stack. It must sit inside AccessLog so the 500 is logged too.
+func Recover(logger *zap.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := newResponseRecorder(w)
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+
+				utils.LoggerFrom(r.Context(), logger).Error("panic recovered",
+					zap.Any("panic", v),
+					zap.String("method", r.Method),
+					zap.String("path", r.URL.Path),
+					zap.ByteString("stack", debug.Stack()),
+				)
+				if !rec.wroteHeader() {
+					utils.SendInternalError(rec)
+				}
+			}()
+
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/avnpl/go-march/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+var tracer = otel.Tracer("github.com/avnpl/go-march/api/middleware")
+
+// Trace starts a server span per request, continuing the caller's trace when
+// a traceparent header is sent, and adds the trace ID to the request logger.
+// It must sit inside RequestID, which installs that logger.
+func Trace(logger *zap.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := tracer.Start(ctx, r.Method,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(r.Method),
+					semconv.URLPath(r.URL.Path),
+					semconv.ClientAddress(clientIP(r)),
+				),
+			)
+			defer span.End()
+
+			if sc := span.SpanContext(); sc.IsValid() {
+				ctx = utils.WithLogger(ctx, utils.LoggerFrom(ctx, logger).With(zap.String("trace_id", sc.TraceID().String())))
+			}
+
+			// The mux sets the pattern on the request it is handed, so keep hold
+			// of the one passed down.
+			r = r.WithContext(ctx)
+			rec := newResponseRecorder(w)
+			next.ServeHTTP(rec, r)
+
+			status := rec.Status()
+			if r.Pattern != "" {
+				span.SetName(r.Method + " " + r.Pattern)
+				span.SetAttributes(semconv.HTTPRoute(r.Pattern))
+			}
+			span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package rest
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/avnpl/go-march/models"
+	"github.com/avnpl/go-march/services"
+	"github.com/avnpl/go-march/utils"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type AdminHandler struct {
+	level      zap.AtomicLevel
+	token      string
+	currencies services.CurrencyService
+	log        *zap.Logger
+	validate   *validator.Validate
+}
+
+func NewAdminHandler(level zap.AtomicLevel, token string, currencies services.CurrencyService, log *zap.Logger, validate *validator.Validate) AdminHandler {
+	return AdminHandler{level: level, token: token, currencies: currencies, log: log, validate: validate}
+}
+
+// LogLevel reports (GET) or changes (PUT {"level":"info"}) the log level of
+// the running server. Without an ADMIN_TOKEN configured the endpoint is off.
+func (h AdminHandler) LogLevel(w http.ResponseWriter, r *http.Request) {
+	if !h.guard(w, r) {
+		return
+	}
+
+	if r.Method != http.MethodPut {
+		h.level.ServeHTTP(w, r)
+		return
+	}
+
+	old := h.level.Level()
+	sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+	h.level.ServeHTTP(sw, r)
+	if sw.status != http.StatusOK {
+		return
+	}
+	// Logged at the new level when it is above info, so the change is not
+	// filtered out by itself, but never at one that exits or panics.
+	to := h.level.Level()
+	if ce := utils.LoggerFrom(r.Context(), h.log).Check(min(max(zapcore.InfoLevel, to), zapcore.ErrorLevel), "log level changed"); ce != nil {
+		ce.Write(zap.String("from", old.String()), zap.String("to", to.String()))
+	}
+}
+
+// statusWriter remembers the status zap answered with, it only sets one when
+// the level could not be changed.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// SaveCurrency creates or renames a currency (PUT /admin/currencies/{code}).
+func (h AdminHandler) SaveCurrency(w http.ResponseWriter, r *http.Request) {
+	if !h.guard(w, r) {
+		return
+	}
+
+	var req models.SaveCurrencyReq
+	if !h.decode(w, r, &req) {
+		return
+	}
+
+	currency, err := h.currencies.SaveCurrency(r.Context(), r.PathValue("code"), &req)
+	if err != nil {
+		utils.LoggerFrom(r.Context(), h.log).Error("SaveCurrency failed", zap.Error(err))
+		utils.SendError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(currency)
+}
+
+func (h AdminHandler) FetchRates(w http.ResponseWriter, r *http.Request) {
+	if !h.guard(w, r) {
+		return
+	}
+
+	rates, err := h.currencies.GetRates(r.Context())
+	if err != nil {
+		utils.LoggerFrom(r.Context(), h.log).Error("FetchRates failed", zap.Error(err))
+		utils.SendError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(rates)
+}
+
+// SetRate stores how many {quote} one {base} buys
+// (PUT /admin/exchange-rates/{base}/{quote}).
+func (h AdminHandler) SetRate(w http.ResponseWriter, r *http.Request) {
+	if !h.guard(w, r) {
+		return
+	}
+
+	var req models.SetExchangeRateReq
+	if !h.decode(w, r, &req) {
+		return
+	}
+
+	rate, err := h.currencies.SetRate(r.Context(), r.PathValue("base"), r.PathValue("quote"), &req)
+	if err != nil {
+		utils.LoggerFrom(r.Context(), h.log).Error("SetRate failed", zap.Error(err))
+		utils.SendError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(rate)
+}
+
+func (h AdminHandler) DeleteRate(w http.ResponseWriter, r *http.Request) {
+	if !h.guard(w, r) {
+		return
+	}
+
+	rate, err := h.currencies.DeleteRate(r.Context(), r.PathValue("base"), r.PathValue("quote"))
+	if err != nil {
+		utils.LoggerFrom(r.Context(), h.log).Error("DeleteRate failed", zap.Error(err))
+		utils.SendError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(rate)
+}
+
+// guard answers the request itself when the admin endpoints are disabled or
+// the token is wrong.
+func (h AdminHandler) guard(w http.ResponseWriter, r *http.Request) bool {
+	if h.token == "" {
+		utils.SendJSONError(w, http.StatusNotFound, "Admin endpoints are disabled")
+		return false
+	}
+	if !h.authorized(r) {
+		utils.SendJSONError(w, http.StatusUnauthorized, "Missing or invalid admin token")
+		return false
+	}
+	return true
+}
+
+func (h AdminHandler) authorized(r *http.Request) bool {
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(given), []byte(h.token)) == 1
+}
+
+func (h AdminHandler) decode(w http.ResponseWriter, r *http.Request, req any) bool {
+	dec := json.NewDecoder(r.Body)
+	dec.UseNumber()
+	if err := dec.Decode(req); err != nil {
+		utils.LoggerFrom(r.Context(), h.log).Error("invalid JSON", zap.Error(err))
+		utils.SendJSONError(w, http.StatusBadRequest, "Invalid JSON")
+		return false
+	}
+	if err := h.validate.Struct(req); err != nil {
+		utils.SendError(w, utils.NewValidationError(err))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,52 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/avnpl/go-march/models"
+	"github.com/avnpl/go-march/services"
+	"github.com/avnpl/go-march/utils"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+)
+
+// CardHandler never logs the request body or the decoded request, both carry
+// the full card number.
+type CardHandler struct {
+	vault    services.CardVault
+	log      *zap.Logger
+	validate *validator.Validate
+}
+
+func NewCardHandler(vault services.CardVault, log *zap.Logger, validate *validator.Validate) CardHandler {
+	return CardHandler{vault: vault, log: log, validate: validate}
+}
+
+func (h CardHandler) TokenizeCard(w http.ResponseWriter, r *http.Request) {
+	log := utils.LoggerFrom(r.Context(), h.log)
+
+	var req models.TokenizeCardReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Error("invalid JSON")
+		utils.SendJSONError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		utils.SendError(w, utils.NewValidationError(err))
+		return
+	}
+
+	card, err := h.vault.Tokenize(r.Context(), &req)
+	if err != nil {
+		if utils.MapError(err).Status == http.StatusInternalServerError {
+			log.Error("TokenizeCard failed", zap.Error(err))
+		}
+		utils.SendError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(card)
+}
@@ -0,0 +1,51 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/avnpl/go-march/models"
+	"github.com/avnpl/go-march/services"
+	"github.com/avnpl/go-march/utils"
+	"go.uber.org/zap"
+)
+
+type CurrencyHandler struct {
+	svc services.CurrencyService
+	log *zap.Logger
+}
+
+func NewCurrencyHandler(svc services.CurrencyService, log *zap.Logger) CurrencyHandler {
+	return CurrencyHandler{svc: svc, log: log}
+}
+
+func (h CurrencyHandler) FetchCurrencies(w http.ResponseWriter, r *http.Request) {
+	currencies, err := h.svc.GetCurrencies(r.Context())
+	if err != nil {
+		utils.LoggerFrom(r.Context(), h.log).Error("FetchCurrencies failed", zap.Error(err))
+		utils.SendError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(currencies)
+}
+
+// convertProducts re-prices products into the ?currency= of the request, if
+// one was asked for.
+func convertProducts(r *http.Request, svc services.CurrencyService, products []models.Product) error {
+	currency := r.URL.Query().Get("currency")
+	if currency == "" {
+		return nil
+	}
+	return svc.ConvertProducts(r.Context(), products, currency)
+}
+
+// convertOrders does the same for order totals.
+func convertOrders(r *http.Request, svc services.CurrencyService, orders []models.Orders) error {
+	currency := r.URL.Query().Get("currency")
+	if currency == "" {
+		return nil
+	}
+	return svc.ConvertOrders(r.Context(), orders, currency)
+}
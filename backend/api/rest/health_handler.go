@@ -0,0 +1,57 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/avnpl/go-march/models"
+	"github.com/avnpl/go-march/services"
+	"github.com/avnpl/go-march/utils"
+	"go.uber.org/zap"
+)
+
+type HealthHandler struct {
+	service services.HealthService
+	log     *zap.Logger
+}
+
+func NewHealthHandler(s services.HealthService, log *zap.Logger) HealthHandler {
+	return HealthHandler{service: s, log: log}
+}
+
+// Livez only tells that the process is serving requests.
+func (h HealthHandler) Livez(w http.ResponseWriter, r *http.Request) {
+	sendHealthStatus(w, http.StatusOK, services.HealthStatusOK)
+}
+
+// Readyz fails while a dependency is down and as soon as shutdown begins.
+func (h HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.Ready(r.Context()); err != nil {
+		utils.LoggerFrom(r.Context(), h.log).Warn("not ready", zap.Error(err))
+		sendHealthStatus(w, http.StatusServiceUnavailable, services.HealthStatusFail)
+		return
+	}
+	sendHealthStatus(w, http.StatusOK, services.HealthStatusOK)
+}
+
+// Health reports every check with its latency and error.
+func (h HealthHandler) Health(w http.ResponseWriter, r *http.Request) {
+	report := h.service.Report(r.Context())
+
+	status := http.StatusOK
+	if report.Status != services.HealthStatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	sendHealth(w, status, report)
+}
+
+func sendHealthStatus(w http.ResponseWriter, status int, value string) {
+	sendHealth(w, status, models.HealthReport{Status: value})
+}
+
+func sendHealth(w http.ResponseWriter, status int, report models.HealthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -1 +1,170 @@
 package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/avnpl/go-march/models"
+	"github.com/avnpl/go-march/services"
+	"github.com/avnpl/go-march/utils"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+)
+
+// Only these fields may be changed through PATCH /orders/{id}. Status is owned
+// by the payment flow, and quantity/product would invalidate the stock count.
+var (
+	updatableOrderFields = map[string]bool{
+		"shipping_address": true,
+		"notes":            true,
+	}
+	readOnlyOrderFields = []string{"status", "quantity", "product_id"}
+)
+
+type OrderHandler struct {
+	svc        services.OrderService
+	currencies services.CurrencyService
+	log        *zap.Logger
+	validate   *validator.Validate
+}
+
+func NewOrderHandler(svc services.OrderService, currencies services.CurrencyService, log *zap.Logger, validate *validator.Validate) OrderHandler {
+	return OrderHandler{svc: svc, currencies: currencies, log: log, validate: validate}
+}
+
+func (h OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
+	log := utils.LoggerFrom(r.Context(), h.log)
+
+	var req models.CreateOrderReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Error("invalid JSON", zap.Error(err))
+		utils.SendJSONError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		utils.SendError(w, utils.NewValidationError(err))
+		return
+	}
+
+	order, err := h.svc.CreateOrder(r.Context(), &req)
+	if err != nil {
+		log.Error("CreateOrder failed", zap.Error(err), zap.String("prod_id", req.ProductID))
+		utils.SendError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(order)
+}
+
+func (h OrderHandler) FetchOrder(w http.ResponseWriter, r *http.Request) {
+	log := utils.LoggerFrom(r.Context(), h.log)
+
+	idStr := r.PathValue("id")
+	if idStr == "" {
+		log.Error("no ID provided in request")
+		utils.SendJSONError(w, http.StatusBadRequest, "No ID provided in the request")
+		return
+	}
+
+	order, err := h.svc.GetOrderByID(r.Context(), idStr)
+	if err != nil {
+		log.Error("GetOrderByID failed", zap.Error(err), zap.String("id", idStr))
+		utils.SendError(w, err)
+		return
+	}
+	orders := []models.Orders{order}
+	if err := convertOrders(r, h.currencies, orders); err != nil {
+		log.Error("ConvertOrders failed", zap.Error(err), zap.String("id", idStr))
+		utils.SendError(w, err)
+		return
+	}
+	order = orders[0]
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(order)
+}
+
+func (h OrderHandler) FetchAllOrders(w http.ResponseWriter, r *http.Request) {
+	orders, err := h.svc.GetAllOrders(r.Context())
+	if err != nil {
+		utils.LoggerFrom(r.Context(), h.log).Error("FetchAllOrders failed", zap.Error(err))
+		utils.SendError(w, err)
+		return
+	}
+	if err := convertOrders(r, h.currencies, orders); err != nil {
+		utils.LoggerFrom(r.Context(), h.log).Error("ConvertOrders failed", zap.Error(err))
+		utils.SendError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(orders)
+}
+
+func (h OrderHandler) UpdateOrder(w http.ResponseWriter, r *http.Request) {
+	log := utils.LoggerFrom(r.Context(), h.log)
+
+	idStr := r.PathValue("id")
+	if idStr == "" {
+		log.Error("no ID provided in request")
+		utils.SendJSONError(w, http.StatusBadRequest, "No ID provided in the request")
+		return
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+		log.Error("invalid JSON", zap.Error(err))
+		utils.SendJSONError(w, http.StatusBadRequest, "Invalid JSON in the Request Body")
+		return
+	}
+
+	for _, field := range readOnlyOrderFields {
+		if _, ok := fields[field]; ok {
+			utils.SendJSONFieldError(w, http.StatusBadRequest, field, fmt.Sprintf("%s cannot be updated", field))
+			return
+		}
+	}
+	for field := range fields {
+		if !updatableOrderFields[field] {
+			utils.SendJSONFieldError(w, http.StatusBadRequest, field, fmt.Sprintf("%s is not a known order field", field))
+			return
+		}
+	}
+	if len(fields) == 0 {
+		utils.SendJSONError(w, http.StatusBadRequest, "Provide shipping_address and/or notes to update")
+		return
+	}
+
+	var req models.UpdateOrderReq
+	for field, raw := range fields {
+		// null would decode to "" and blank the column; clearing is spelled "".
+		if string(raw) == "null" {
+			utils.SendJSONFieldError(w, http.StatusBadRequest, field, fmt.Sprintf(`%s cannot be null, send "" to clear it`, field))
+			return
+		}
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			utils.SendJSONFieldError(w, http.StatusBadRequest, field, fmt.Sprintf("%s must be a string", field))
+			return
+		}
+		switch field {
+		case "shipping_address":
+			req.ShippingAddress = &value
+		case "notes":
+			req.Notes = &value
+		}
+	}
+
+	order, err := h.svc.UpdateOrder(r.Context(), idStr, &req)
+	if err != nil {
+		log.Error("UpdateOrder failed", zap.Error(err), zap.String("id", idStr))
+		utils.SendError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(order)
+}
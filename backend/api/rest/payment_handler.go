@@ -0,0 +1,70 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/avnpl/go-march/models"
+	"github.com/avnpl/go-march/services"
+	"github.com/avnpl/go-march/utils"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+)
+
+type PaymentHandler struct {
+	svc      services.PaymentService
+	log      *zap.Logger
+	validate *validator.Validate
+}
+
+func NewPaymentHandler(svc services.PaymentService, log *zap.Logger, validate *validator.Validate) PaymentHandler {
+	return PaymentHandler{svc: svc, log: log, validate: validate}
+}
+
+func (h PaymentHandler) CreatePayment(w http.ResponseWriter, r *http.Request) {
+	log := utils.LoggerFrom(r.Context(), h.log)
+
+	var req models.CreatePaymentReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		// The decode error can quote the card number, so it is not logged.
+		log.Error("invalid JSON")
+		utils.SendJSONError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		utils.SendError(w, utils.NewValidationError(err))
+		return
+	}
+
+	payment, err := h.svc.CreatePayment(r.Context(), &req)
+	if err != nil {
+		log.Error("CreatePayment failed", zap.Error(err), zap.String("order_id", req.OrderID))
+		utils.SendError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(payment)
+}
+
+func (h PaymentHandler) FetchPayment(w http.ResponseWriter, r *http.Request) {
+	log := utils.LoggerFrom(r.Context(), h.log)
+
+	idStr := r.PathValue("id")
+	if idStr == "" {
+		log.Error("no ID provided in request")
+		utils.SendJSONError(w, http.StatusBadRequest, "No ID provided in the request")
+		return
+	}
+
+	payment, err := h.svc.GetPaymentByID(r.Context(), idStr)
+	if err != nil {
+		log.Error("GetPaymentByID failed", zap.Error(err), zap.String("id", idStr))
+		utils.SendError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(payment)
+}
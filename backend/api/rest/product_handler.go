@@ -1,15 +1,16 @@
 package rest
 
 import (
-	"bytes"
-	"database/sql"
 	"encoding/json"
 	"errors"
-	"io"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/avnpl/go-march/models"
+	"github.com/avnpl/go-march/money"
 	"github.com/avnpl/go-march/services"
 	"github.com/avnpl/go-march/utils"
 	"github.com/go-playground/validator/v10"
@@ -17,52 +18,35 @@ import (
 )
 
 type ProductHandler struct {
-	svc      services.ProductService
-	log      *zap.Logger
-	validate *validator.Validate
+	svc        services.ProductService
+	currencies services.CurrencyService
+	log        *zap.Logger
+	validate   *validator.Validate
 }
 
-func NewProductHandler(svc services.ProductService, log *zap.Logger, validate *validator.Validate) ProductHandler {
-	return ProductHandler{svc: svc, log: log, validate: validate}
+func NewProductHandler(svc services.ProductService, currencies services.CurrencyService, log *zap.Logger, validate *validator.Validate) ProductHandler {
+	return ProductHandler{svc: svc, currencies: currencies, log: log, validate: validate}
 }
 
 func (h ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
-	bodyBytes, err := io.ReadAll(r.Body)
-	if err != nil {
-		h.log.Error("error reading the request body", zap.Error(err))
-		utils.SendJSONError(w, http.StatusBadRequest, "Invalid JSON")
-		return
-	}
-
-	reqString := string(bodyBytes)
-	h.log.Debug("raw body",
-		zap.Int("length", len(bodyBytes)),
-		zap.String("body", strings.ReplaceAll(reqString, " ", "")),
-	)
-	r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+	log := utils.LoggerFrom(r.Context(), h.log)
 
 	var req models.CreateProductReq
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.log.Error("invalid JSON", zap.Error(err))
-		utils.SendJSONError(w, http.StatusBadRequest, "Invalid JSON")
+		log.Error("invalid JSON", zap.Error(err))
+		sendProductDecodeError(w, err, "Invalid JSON")
 		return
 	}
 
-	err = h.validate.Struct(req)
-	if err != nil {
-		message := utils.FormatValidationErrors(err)
-		utils.SendJSONError(w, http.StatusBadRequest, message)
+	if err := h.validate.Struct(req); err != nil {
+		utils.SendError(w, utils.NewValidationError(err))
 		return
 	}
 
 	prod, err := h.svc.CreateProduct(r.Context(), &req)
 	if err != nil {
-		h.log.Error("CreateProduct failed", zap.Error(err))
-		if errors.Is(err, utils.ErrConflict) {
-			utils.SendJSONError(w, http.StatusConflict, "")
-			return
-		}
-		utils.SendInternalError(w)
+		log.Error("CreateProduct failed", zap.Error(err))
+		utils.SendError(w, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -70,80 +54,188 @@ func (h ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(prod)
 }
 
+// sendProductDecodeError points at the price when that is what failed to
+// decode, price is the only product field with a format of its own.
+func sendProductDecodeError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, money.ErrTooPrecise):
+		utils.SendJSONFieldError(w, http.StatusBadRequest, "price", "price must have at most 2 decimal places")
+	case errors.Is(err, money.ErrInvalidAmount):
+		utils.SendJSONFieldError(w, http.StatusBadRequest, "price", "price must be a decimal number")
+	default:
+		utils.SendJSONError(w, http.StatusBadRequest, message)
+	}
+}
+
 func (h ProductHandler) FetchProduct(w http.ResponseWriter, r *http.Request) {
+	log := utils.LoggerFrom(r.Context(), h.log)
+
 	idStr := r.PathValue("id")
 	if idStr == "" {
-		h.log.Error("no ID provided in request")
+		log.Error("no ID provided in request")
 		utils.SendJSONError(w, http.StatusBadRequest, "No ID provided in the request")
 		return
 	}
 
-	h.log.Debug("received ID => ", zap.String("request param", idStr))
+	log.Debug("received ID => ", zap.String("request param", idStr))
 
 	prod, err := h.svc.GetProductByID(r.Context(), idStr)
 	if err != nil {
-		h.log.Error("GetProductByID failed", zap.Error(err))
-		if errors.Is(err, sql.ErrNoRows) {
-			utils.SendJSONError(w, http.StatusNotFound, "Record with given ID not found")
-			return
-		}
-		utils.SendInternalError(w)
+		log.Error("GetProductByID failed", zap.Error(err))
+		utils.SendError(w, err)
+		return
+	}
+	products := []models.Product{prod}
+	if err := convertProducts(r, h.currencies, products); err != nil {
+		log.Error("ConvertProducts failed", zap.Error(err))
+		utils.SendError(w, err)
 		return
 	}
+	prod = products[0]
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	_ = json.NewEncoder(w).Encode(prod)
 }
 
 func (h ProductHandler) FetchAllProducts(w http.ResponseWriter, r *http.Request) {
-	prods, err := h.svc.GetAllProducts(r.Context())
+	opts, field, ok := parseProductListOpts(r.URL.Query())
+	if !ok {
+		utils.SendJSONFieldError(w, http.StatusBadRequest, field, fmt.Sprintf("Invalid value for %s", field))
+		return
+	}
+
+	page, err := h.svc.GetAllProducts(r.Context(), opts)
 	if err != nil {
-		h.log.Error("FetchAllProducts failed", zap.Error(err))
-		utils.SendInternalError(w)
+		utils.LoggerFrom(r.Context(), h.log).Error("FetchAllProducts failed", zap.Error(err))
+		utils.SendError(w, err)
+		return
+	}
+	if err := convertProducts(r, h.currencies, page.Products); err != nil {
+		utils.LoggerFrom(r.Context(), h.log).Error("ConvertProducts failed", zap.Error(err))
+		utils.SendError(w, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(prods)
+	json.NewEncoder(w).Encode(page)
 }
 
-func (h ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
-	bodyBytes, err := io.ReadAll(r.Body)
-	if err != nil {
-		h.log.Error("error reading the request body", zap.Error(err))
-		utils.SendInternalError(w)
-		return
+// parseProductListOpts reads the paging, sorting and filter query parameters.
+// On failure it returns the name of the offending parameter.
+func parseProductListOpts(q url.Values) (models.ProductListOpts, string, bool) {
+	opts := models.ProductListOpts{
+		Cursor:        q.Get("cursor"),
+		Sort:          q.Get("sort"),
+		NameContains:  q.Get("name_contains"),
+		PriceCurrency: q.Get("price_currency"),
 	}
 
-	reqString := string(bodyBytes)
-	h.log.Debug("raw body",
-		zap.Int("length", len(bodyBytes)),
-		zap.String("body", strings.ReplaceAll(reqString, " ", "")),
-	)
-	r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > services.MaxProductPageSize {
+			return opts, "limit", false
+		}
+		opts.Limit = limit
+	}
 
-	var req models.UpdateProductReq
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.log.Error("invalid JSON", zap.Error(err))
-		utils.SendJSONError(w, http.StatusBadRequest, "Invalid JSON in the Request Body")
+	if opts.Sort != "" {
+		if _, ok := models.ProductSortColumns[strings.TrimPrefix(opts.Sort, "-")]; !ok {
+			return opts, "sort", false
+		}
+	}
+
+	for _, f := range []struct {
+		name string
+		dst  **money.Amount
+	}{{"min_price", &opts.MinPrice}, {"max_price", &opts.MaxPrice}} {
+		v := q.Get(f.name)
+		if v == "" {
+			continue
+		}
+		price, err := money.Parse(v)
+		if err != nil || price < 0 {
+			return opts, f.name, false
+		}
+		*f.dst = &price
+	}
+
+	if v := q.Get("in_stock"); v != "" {
+		inStock, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, "in_stock", false
+		}
+		opts.InStock = &inStock
+	}
+
+	return opts, "", true
+}
+
+// UpdateProduct applies a patch to one product, addressed by PATCH
+// /product/{id} or, for plain JSON and merge patches, by prod_id in the body of
+// PATCH /product. The body is an RFC 7396 merge patch (application/json or
+// application/merge-patch+json) or an RFC 6902 JSON Patch
+// (application/json-patch+json).
+func (h ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
+	log := utils.LoggerFrom(r.Context(), h.log)
+
+	kind, perr := patchKind(r)
+	if perr != nil {
+		perr.send(w)
 		return
 	}
 
-	err = h.validate.Struct(req)
-	if err != nil {
-		message := utils.FormatValidationErrors(err)
-		utils.SendJSONError(w, http.StatusBadRequest, message)
+	req := models.UpdateProductReq{ProductID: r.PathValue("id")}
+	switch kind {
+	case mergePatchType:
+		var fields map[string]json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+			log.Error("invalid JSON", zap.Error(err))
+			utils.SendJSONError(w, http.StatusBadRequest, "Invalid JSON in the Request Body")
+			return
+		}
+		if req.ProductID == "" {
+			if err := json.Unmarshal(fields["prod_id"], &req.ProductID); err != nil || req.ProductID == "" {
+				utils.SendJSONFieldError(w, http.StatusBadRequest, "prod_id", "prod_id is required")
+				return
+			}
+			delete(fields, "prod_id")
+		}
+		if perr := applyMergePatch(fields, &req); perr != nil {
+			perr.send(w)
+			return
+		}
+	case jsonPatchType:
+		if req.ProductID == "" {
+			utils.SendJSONError(w, http.StatusBadRequest, "Send a JSON Patch to /product/{id}")
+			return
+		}
+		var ops []jsonPatchOp
+		if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+			log.Error("invalid JSON", zap.Error(err))
+			utils.SendJSONError(w, http.StatusBadRequest, "Invalid JSON Patch in the Request Body")
+			return
+		}
+		err := applyJSONPatch(ops, &req)
+		if errors.As(err, &perr) {
+			perr.send(w)
+			return
+		}
+		if err != nil {
+			log.Error("UpdateProduct failed", zap.Error(err))
+			utils.SendError(w, err)
+			return
+		}
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		utils.SendError(w, utils.NewValidationError(err))
 		return
 	}
 
 	prod, err := h.svc.UpdateProduct(r.Context(), &req)
 	if err != nil {
-		if errors.Is(err, utils.ErrConflict) {
-			utils.SendJSONError(w, http.StatusConflict, "")
-			return
-		}
-		utils.SendInternalError(w)
-		h.log.Error("UpdateProduct failed", zap.Error(err))
+		log.Error("UpdateProduct failed", zap.Error(err))
+		utils.SendError(w, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -152,23 +244,21 @@ func (h ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h ProductHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
+	log := utils.LoggerFrom(r.Context(), h.log)
+
 	idStr := r.PathValue("id")
 	if idStr == "" {
-		h.log.Error("no ID provided in request")
+		log.Error("no ID provided in request")
 		utils.SendJSONError(w, http.StatusBadRequest, "No ID provided in the request")
 		return
 	}
 
-	h.log.Debug("received ID => ", zap.String("request param", idStr))
+	log.Debug("received ID => ", zap.String("request param", idStr))
 
 	prod, err := h.svc.DeleteProduct(r.Context(), idStr)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			utils.SendJSONError(w, http.StatusNotFound, "Record with given ID not found")
-			return
-		}
-		h.log.Error("DeleteProductByID failed", zap.Error(err))
-		utils.SendInternalError(w)
+		log.Error("DeleteProductByID failed", zap.Error(err))
+		utils.SendError(w, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
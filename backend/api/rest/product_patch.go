@@ -0,0 +1,194 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/avnpl/go-march/models"
+	"github.com/avnpl/go-march/money"
+	"github.com/avnpl/go-march/utils"
+)
+
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+// Only these fields may be changed by a product patch, the others are either
+// the identity of the product or maintained by the server.
+var readOnlyProductFields = []string{"prod_id", "currency", "created_at", "updated_at"}
+
+// patchError is a rejected patch, reported against the field it concerns.
+type patchError struct {
+	status  int
+	field   string
+	message string
+}
+
+func (e *patchError) Error() string {
+	return e.message
+}
+
+func (e *patchError) send(w http.ResponseWriter) {
+	if e.status == http.StatusUnsupportedMediaType {
+		w.Header().Set("Accept-Patch", mergePatchType+", "+jsonPatchType)
+	}
+	utils.SendJSONFieldError(w, e.status, e.field, e.message)
+}
+
+func badPatch(field string, format string, args ...any) *patchError {
+	return &patchError{status: http.StatusBadRequest, field: field, message: fmt.Sprintf(format, args...)}
+}
+
+// patchKind tells from the Content-Type which kind of patch the body is. Plain
+// JSON is read as a merge patch, which is what it always meant here.
+func patchKind(r *http.Request) (string, *patchError) {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return mergePatchType, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", &patchError{status: http.StatusUnsupportedMediaType, message: "Invalid Content-Type"}
+	}
+	switch mediaType {
+	case "application/json", mergePatchType:
+		return mergePatchType, nil
+	case jsonPatchType:
+		return jsonPatchType, nil
+	default:
+		return "", &patchError{status: http.StatusUnsupportedMediaType, message: fmt.Sprintf("Unsupported patch type %s", mediaType)}
+	}
+}
+
+// applyMergePatch reads an RFC 7396 merge patch into req. Every product column
+// is required, so null (remove the member) is rejected rather than ignored.
+func applyMergePatch(fields map[string]json.RawMessage, req *models.UpdateProductReq) *patchError {
+	for field, raw := range fields {
+		if err := setProductField(req, field, raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type jsonPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// applyJSONPatch reads an RFC 6902 JSON Patch into req. Operations apply in
+// order, so a test of a field an earlier operation set is decided here. Any
+// other test goes into req.Test, which the update checks against the stored
+// row in the same statement that writes it.
+func applyJSONPatch(ops []jsonPatchOp, req *models.UpdateProductReq) error {
+	if len(ops) == 0 {
+		return utils.ErrEmptyPatch
+	}
+	for i, op := range ops {
+		field, ok := strings.CutPrefix(op.Path, "/")
+		if !ok {
+			return badPatch("path", "operation %d: path must start with /", i)
+		}
+		field = strings.NewReplacer("~1", "/", "~0", "~").Replace(field)
+
+		switch op.Op {
+		case "add", "replace":
+			if op.Value == nil {
+				return badPatch(field, "operation %d: %s needs a value", i, op.Op)
+			}
+			if err := setProductField(req, field, op.Value); err != nil {
+				return err
+			}
+		case "test":
+			var want models.UpdateProductReq
+			if err := setProductField(&want, field, op.Value); err != nil {
+				return err
+			}
+			if !testProduct(req, want) {
+				return utils.InField(field, utils.ErrPatchTestFailed)
+			}
+		case "remove":
+			return badPatch(field, "%s cannot be removed", field)
+		case "move", "copy":
+			return badPatch("op", "operation %d: %s is not supported", i, op.Op)
+		default:
+			return badPatch("op", "operation %d: unknown op %q", i, op.Op)
+		}
+	}
+	return nil
+}
+
+// setProductField sets one patched field on req from its raw JSON value.
+func setProductField(req *models.UpdateProductReq, field string, raw json.RawMessage) *patchError {
+	for _, readOnly := range readOnlyProductFields {
+		if field == readOnly {
+			return badPatch(field, "%s cannot be updated", field)
+		}
+	}
+	if string(raw) == "null" {
+		switch field {
+		case "prod_name", "name", "price", "stock":
+			return badPatch(field, "%s cannot be null", field)
+		}
+	}
+
+	switch field {
+	case "prod_name", "name":
+		field = "prod_name"
+		var name string
+		if err := json.Unmarshal(raw, &name); err != nil {
+			return badPatch(field, "prod_name must be a string")
+		}
+		req.Name = &name
+	case "price":
+		var price money.Amount
+		if err := json.Unmarshal(raw, &price); err != nil {
+			if errors.Is(err, money.ErrTooPrecise) {
+				return badPatch(field, "price must have at most 2 decimal places")
+			}
+			return badPatch(field, "price must be a decimal number")
+		}
+		req.Price = &price
+	case "stock":
+		var stock int
+		if err := json.Unmarshal(raw, &stock); err != nil {
+			return badPatch(field, "stock must be an integer")
+		}
+		req.Stock = &stock
+	default:
+		return badPatch(field, "%s is not a known product field", field)
+	}
+	return nil
+}
+
+// testProduct checks the one field set in want. It is false only when the
+// test is sure to fail: the field was set by an earlier operation, or tested
+// already, with another value.
+func testProduct(req *models.UpdateProductReq, want models.UpdateProductReq) bool {
+	switch {
+	case want.Name != nil:
+		return testField(req.Name, &req.Test.Name, *want.Name)
+	case want.Price != nil:
+		return testField(req.Price, &req.Test.Price, *want.Price)
+	default:
+		return testField(req.Stock, &req.Test.Stock, *want.Stock)
+	}
+}
+
+func testField[T comparable](set *T, test **T, want T) bool {
+	if set != nil {
+		return *set == want
+	}
+	if *test != nil {
+		return **test == want
+	}
+	*test = &want
+	return true
+}
@@ -0,0 +1,146 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/avnpl/go-march/models"
+	"github.com/avnpl/go-march/money"
+	"github.com/avnpl/go-march/utils"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// wantPatch is the outcome of a patch: the request it builds, or the field and
+// status of the error it is rejected with.
+type wantPatch struct {
+	req    models.UpdateProductReq
+	field  string
+	status int
+}
+
+func checkPatch(t *testing.T, got models.UpdateProductReq, err error, want wantPatch) {
+	t.Helper()
+	if want.status != 0 {
+		if err == nil {
+			t.Fatalf("want a %d error on %q, got none", want.status, want.field)
+		}
+		var perr *patchError
+		if errors.As(err, &perr) {
+			if perr.status != want.status || perr.field != want.field {
+				t.Fatalf("got %d on %q (%s), want %d on %q", perr.status, perr.field, perr.message, want.status, want.field)
+			}
+			return
+		}
+		res := utils.MapError(err)
+		if res.Status != want.status || res.Field != want.field {
+			t.Fatalf("got %d on %q (%v), want %d on %q", res.Status, res.Field, err, want.status, want.field)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want.req) {
+		t.Fatalf("got %s, want %s", describe(got), describe(want.req))
+	}
+}
+
+func describe(req models.UpdateProductReq) string {
+	b, _ := json.Marshal(req)
+	t, _ := json.Marshal(req.Test)
+	return string(b) + " test " + string(t)
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+		want  wantPatch
+	}{
+		{name: "every field", patch: `{"prod_name": "Pen", "price": "1.50", "stock": 0}`,
+			want: wantPatch{req: models.UpdateProductReq{Name: ptr("Pen"), Price: ptr(money.Amount(150)), Stock: ptr(0)}}},
+		{name: "name alias", patch: `{"name": "Pen"}`, want: wantPatch{req: models.UpdateProductReq{Name: ptr("Pen")}}},
+		{name: "price as number", patch: `{"price": 2}`, want: wantPatch{req: models.UpdateProductReq{Price: ptr(money.Amount(200))}}},
+		{name: "empty", patch: `{}`, want: wantPatch{}},
+		{name: "null", patch: `{"stock": null}`, want: wantPatch{field: "stock", status: http.StatusBadRequest}},
+		{name: "read only", patch: `{"currency": "EUR"}`, want: wantPatch{field: "currency", status: http.StatusBadRequest}},
+		{name: "unknown field", patch: `{"color": "red"}`, want: wantPatch{field: "color", status: http.StatusBadRequest}},
+		{name: "too precise", patch: `{"price": "1.005"}`, want: wantPatch{field: "price", status: http.StatusBadRequest}},
+		{name: "wrong type", patch: `{"stock": "3"}`, want: wantPatch{field: "stock", status: http.StatusBadRequest}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal([]byte(tt.patch), &fields); err != nil {
+				t.Fatal(err)
+			}
+			var req models.UpdateProductReq
+			var err error
+			if perr := applyMergePatch(fields, &req); perr != nil {
+				err = perr
+			}
+			checkPatch(t, req, err, tt.want)
+		})
+	}
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+		want  wantPatch
+	}{
+		{name: "replace", patch: `[{"op": "replace", "path": "/stock", "value": 0}]`,
+			want: wantPatch{req: models.UpdateProductReq{Stock: ptr(0)}}},
+		{name: "add is replace", patch: `[{"op": "add", "path": "/prod_name", "value": "Pen"}]`,
+			want: wantPatch{req: models.UpdateProductReq{Name: ptr("Pen")}}},
+		{name: "test before replace is left to the update",
+			patch: `[{"op": "test", "path": "/stock", "value": 3}, {"op": "replace", "path": "/stock", "value": 0}]`,
+			want:  wantPatch{req: models.UpdateProductReq{Stock: ptr(0), Test: models.ProductTest{Stock: ptr(3)}}}},
+		{name: "test after replace passes",
+			patch: `[{"op": "replace", "path": "/price", "value": "9.99"}, {"op": "test", "path": "/price", "value": 9.99}]`,
+			want:  wantPatch{req: models.UpdateProductReq{Price: ptr(money.Amount(999))}}},
+		{name: "test after replace fails",
+			patch: `[{"op": "replace", "path": "/stock", "value": 0}, {"op": "test", "path": "/stock", "value": 3}]`,
+			want:  wantPatch{field: "stock", status: http.StatusConflict}},
+		{name: "conflicting tests fail",
+			patch: `[{"op": "test", "path": "/name", "value": "Pen"}, {"op": "test", "path": "/prod_name", "value": "Ink"}, {"op": "replace", "path": "/stock", "value": 1}]`,
+			want:  wantPatch{field: "prod_name", status: http.StatusConflict}},
+		{name: "empty", patch: `[]`, want: wantPatch{status: http.StatusBadRequest}},
+		{name: "path without slash", patch: `[{"op": "replace", "path": "stock", "value": 1}]`,
+			want: wantPatch{field: "path", status: http.StatusBadRequest}},
+		{name: "unknown path", patch: `[{"op": "replace", "path": "/color", "value": "red"}]`,
+			want: wantPatch{field: "color", status: http.StatusBadRequest}},
+		{name: "nested path", patch: `[{"op": "replace", "path": "/stock/0", "value": 1}]`,
+			want: wantPatch{field: "stock/0", status: http.StatusBadRequest}},
+		{name: "escaped path", patch: `[{"op": "replace", "path": "/a~1b", "value": 1}]`,
+			want: wantPatch{field: "a/b", status: http.StatusBadRequest}},
+		{name: "read only path", patch: `[{"op": "replace", "path": "/prod_id", "value": "PR1"}]`,
+			want: wantPatch{field: "prod_id", status: http.StatusBadRequest}},
+		{name: "missing value", patch: `[{"op": "replace", "path": "/stock"}]`,
+			want: wantPatch{field: "stock", status: http.StatusBadRequest}},
+		{name: "remove", patch: `[{"op": "remove", "path": "/stock"}]`,
+			want: wantPatch{field: "stock", status: http.StatusBadRequest}},
+		{name: "move", patch: `[{"op": "move", "from": "/stock", "path": "/price"}]`,
+			want: wantPatch{field: "op", status: http.StatusBadRequest}},
+		{name: "unknown op", patch: `[{"op": "merge", "path": "/stock", "value": 1}]`,
+			want: wantPatch{field: "op", status: http.StatusBadRequest}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ops []jsonPatchOp
+			if err := json.Unmarshal([]byte(tt.patch), &ops); err != nil {
+				t.Fatal(err)
+			}
+			var req models.UpdateProductReq
+			err := applyJSONPatch(ops, &req)
+			checkPatch(t, req, err, tt.want)
+		})
+	}
+}
@@ -0,0 +1,424 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Env        string        `yaml:"env"`
+	Port       string        `yaml:"port"`
+	AdminToken string        `yaml:"admin_token"`
+	Log        LogConfig     `yaml:"log"`
+	HTTP       HTTPConfig    `yaml:"http"`
+	DB         DBConfig      `yaml:"db"`
+	TTL        TTLConfig     `yaml:"ttl"`
+	Tracing    TracingConfig `yaml:"tracing"`
+	GraphQL    GraphQLConfig `yaml:"graphql"`
+}
+
+type LogConfig struct {
+	Level      string `yaml:"level"`
+	File       string `yaml:"file"`
+	MaxSizeMB  int    `yaml:"max_size_mb"`
+	MaxBackups int    `yaml:"max_backups"`
+}
+
+type HTTPConfig struct {
+	ReadTimeout     time.Duration `yaml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	DrainDelay      time.Duration `yaml:"drain_delay"`
+}
+
+type DBConfig struct {
+	URL             string        `yaml:"url"`
+	Dialect         string        `yaml:"dialect"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	AutoMigrate     bool          `yaml:"auto_migrate"`
+}
+
+type TTLConfig struct {
+	Duration     time.Duration `yaml:"duration"`
+	Reaper       string        `yaml:"reaper"`
+	ReapInterval time.Duration `yaml:"reap_interval"`
+}
+
+type TracingConfig struct {
+	Exporter     string  `yaml:"exporter"`
+	OTLPEndpoint string  `yaml:"otlp_endpoint"`
+	File         string  `yaml:"file"`
+	SampleRatio  float64 `yaml:"sample_ratio"`
+}
+
+type GraphQLConfig struct {
+	MaxBodyBytes     int `yaml:"max_body_bytes"`
+	MaxDepth         int `yaml:"max_depth"`
+	MaxAliases       int `yaml:"max_aliases"`
+	MaxCost          int `yaml:"max_cost"`
+	MaxSubscriptions int `yaml:"max_subscriptions"`
+}
+
+func defaults() Config {
+	return Config{
+		Env:  "development",
+		Port: ":8013",
+		Log: LogConfig{
+			File:       "logs/app.log",
+			MaxSizeMB:  10,
+			MaxBackups: 5,
+		},
+		HTTP: HTTPConfig{
+			ReadTimeout:     5 * time.Second,
+			WriteTimeout:    10 * time.Second,
+			IdleTimeout:     120 * time.Second,
+			ShutdownTimeout: 10 * time.Second,
+			DrainDelay:      5 * time.Second,
+		},
+		DB: DBConfig{
+			MaxOpenConns:    25,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 10 * time.Second,
+		},
+		TTL: TTLConfig{
+			Duration:     3 * time.Hour,
+			Reaper:       "auto",
+			ReapInterval: time.Minute,
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			File:        "logs/traces.json",
+			SampleRatio: 1,
+		},
+		GraphQL: GraphQLConfig{
+			MaxBodyBytes:     1 << 20,
+			MaxDepth:         8,
+			MaxAliases:       15,
+			MaxCost:          1000,
+			MaxSubscriptions: 20,
+		},
+	}
+}
+
+// Load builds the configuration from, in increasing precedence: the defaults,
+// the YAML file named by CONFIG_FILE, and the environment (which .env adds to
+// without overriding). Every invalid setting is reported in the returned error.
+func Load() (Config, error) {
+	if err := godotenv.Load(".env"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Config{}, fmt.Errorf("config.Load: .env: %w", err)
+	}
+
+	cfg := defaults()
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return Config{}, fmt.Errorf("config.Load: %w", err)
+		}
+	}
+
+	var errs []error
+	e := envReader{errs: &errs}
+	e.str("ENV", &cfg.Env)
+	e.str("PORT", &cfg.Port)
+	e.str("ADMIN_TOKEN", &cfg.AdminToken)
+	e.str("LOG_LEVEL", &cfg.Log.Level)
+	e.str("LOG_FILE", &cfg.Log.File)
+	e.integer("LOG_MAX_SIZE_MB", &cfg.Log.MaxSizeMB)
+	e.integer("LOG_MAX_BACKUPS", &cfg.Log.MaxBackups)
+	e.duration("HTTP_READ_TIMEOUT", &cfg.HTTP.ReadTimeout)
+	e.duration("HTTP_WRITE_TIMEOUT", &cfg.HTTP.WriteTimeout)
+	e.duration("HTTP_IDLE_TIMEOUT", &cfg.HTTP.IdleTimeout)
+	e.duration("SHUTDOWN_TIMEOUT", &cfg.HTTP.ShutdownTimeout)
+	e.duration("SHUTDOWN_DRAIN_DELAY", &cfg.HTTP.DrainDelay)
+	e.str("DB_URL", &cfg.DB.URL)
+	e.str("DB_DIALECT", &cfg.DB.Dialect)
+	e.integer("DB_MAX_OPEN_CONNS", &cfg.DB.MaxOpenConns)
+	e.integer("DB_MAX_IDLE_CONNS", &cfg.DB.MaxIdleConns)
+	e.seconds("DB_MAX_CONN_LIFETIME_SEC", &cfg.DB.ConnMaxLifetime)
+	e.boolean("AUTO_MIGRATE", &cfg.DB.AutoMigrate)
+	e.duration("TTL_DURATION", &cfg.TTL.Duration)
+	e.str("TTL_REAPER", &cfg.TTL.Reaper)
+	e.duration("TTL_REAP_INTERVAL", &cfg.TTL.ReapInterval)
+	e.str("TRACING_EXPORTER", &cfg.Tracing.Exporter)
+	e.str("TRACING_OTLP_ENDPOINT", &cfg.Tracing.OTLPEndpoint)
+	e.str("TRACING_FILE", &cfg.Tracing.File)
+	e.float("TRACING_SAMPLE_RATIO", &cfg.Tracing.SampleRatio)
+	e.integer("GRAPHQL_MAX_BODY_BYTES", &cfg.GraphQL.MaxBodyBytes)
+	e.integer("GRAPHQL_MAX_DEPTH", &cfg.GraphQL.MaxDepth)
+	e.integer("GRAPHQL_MAX_ALIASES", &cfg.GraphQL.MaxAliases)
+	e.integer("GRAPHQL_MAX_COST", &cfg.GraphQL.MaxCost)
+	e.integer("GRAPHQL_MAX_SUBSCRIPTIONS", &cfg.GraphQL.MaxSubscriptions)
+
+	// The level defaults by environment, so production does not log at debug
+	// unless asked to.
+	if cfg.Log.Level == "" {
+		cfg.Log.Level = "debug"
+		if cfg.Production() {
+			cfg.Log.Level = "info"
+		}
+	}
+
+	errs = append(errs, cfg.validate()...)
+	if len(errs) > 0 {
+		return cfg, fmt.Errorf("config.Load: invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return cfg, nil
+}
+
+func loadFile(path string, cfg *Config) error {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+	default:
+		return fmt.Errorf("%s: unsupported config file type %q, expected .yaml or .yml", path, ext)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	dec := yaml.NewDecoder(strings.NewReader(string(raw)))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func (c Config) validate() []error {
+	var errs []error
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if _, port, err := net.SplitHostPort(c.Port); err != nil {
+		add("PORT: %q is not a host:port address", c.Port)
+	} else if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		add("PORT: %q is not a valid port", port)
+	}
+
+	switch c.Env {
+	case "development", "production":
+	default:
+		add("ENV: %q is not one of development, production", c.Env)
+	}
+
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		add("LOG_LEVEL: %q is not one of debug, info, warn, error", c.Log.Level)
+	}
+	if c.Log.MaxSizeMB < 1 {
+		add("LOG_MAX_SIZE_MB: must be at least 1, got %d", c.Log.MaxSizeMB)
+	}
+	if c.Log.MaxBackups < 0 {
+		add("LOG_MAX_BACKUPS: must not be negative, got %d", c.Log.MaxBackups)
+	}
+
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"HTTP_READ_TIMEOUT", c.HTTP.ReadTimeout},
+		{"HTTP_WRITE_TIMEOUT", c.HTTP.WriteTimeout},
+		{"HTTP_IDLE_TIMEOUT", c.HTTP.IdleTimeout},
+		{"SHUTDOWN_TIMEOUT", c.HTTP.ShutdownTimeout},
+		{"TTL_REAP_INTERVAL", c.TTL.ReapInterval},
+	} {
+		if d.value <= 0 {
+			add("%s: must be positive, got %s", d.name, d.value)
+		}
+	}
+
+	if c.HTTP.DrainDelay < 0 {
+		add("SHUTDOWN_DRAIN_DELAY: must not be negative, got %s", c.HTTP.DrainDelay)
+	}
+
+	if c.DB.URL == "" {
+		add("DB_URL: is required")
+	} else if _, err := pgx.ParseConfig(c.DB.URL); err != nil {
+		add("DB_URL: is not a valid connection URL or key=value string")
+	}
+	switch c.DB.Dialect {
+	case "", "cockroach", "postgres":
+	default:
+		add("DB_DIALECT: %q is not one of cockroach, postgres", c.DB.Dialect)
+	}
+	if c.DB.MaxOpenConns < 1 {
+		add("DB_MAX_OPEN_CONNS: must be at least 1, got %d", c.DB.MaxOpenConns)
+	}
+	if c.DB.MaxIdleConns < 0 || c.DB.MaxIdleConns > c.DB.MaxOpenConns {
+		add("DB_MAX_IDLE_CONNS: must be between 0 and DB_MAX_OPEN_CONNS (%d), got %d", c.DB.MaxOpenConns, c.DB.MaxIdleConns)
+	}
+	if c.DB.ConnMaxLifetime < 0 {
+		add("DB_MAX_CONN_LIFETIME_SEC: must not be negative")
+	}
+
+	if c.TTL.Duration < time.Minute {
+		add("TTL_DURATION: must be at least 1m, got %s", c.TTL.Duration)
+	}
+	switch c.TTL.Reaper {
+	case "auto", "on", "off":
+	default:
+		add("TTL_REAPER: %q is not one of auto, on, off", c.TTL.Reaper)
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "otlp", "stdout":
+	case "file":
+		if c.Tracing.File == "" {
+			add("TRACING_FILE: is required when TRACING_EXPORTER is file")
+		}
+	default:
+		add("TRACING_EXPORTER: %q is not one of none, otlp, stdout, file", c.Tracing.Exporter)
+	}
+	if c.Tracing.OTLPEndpoint != "" {
+		if u, err := url.Parse(c.Tracing.OTLPEndpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			add("TRACING_OTLP_ENDPOINT: %q is not a URL like http://localhost:4318", c.Tracing.OTLPEndpoint)
+		}
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		add("TRACING_SAMPLE_RATIO: must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+	}
+
+	if c.GraphQL.MaxBodyBytes <= 0 {
+		add("GRAPHQL_MAX_BODY_BYTES: must be positive, got %d", c.GraphQL.MaxBodyBytes)
+	}
+	if c.GraphQL.MaxDepth <= 0 {
+		add("GRAPHQL_MAX_DEPTH: must be positive, got %d", c.GraphQL.MaxDepth)
+	}
+	if c.GraphQL.MaxAliases < 0 {
+		add("GRAPHQL_MAX_ALIASES: must not be negative, got %d", c.GraphQL.MaxAliases)
+	}
+	if c.GraphQL.MaxCost <= 0 {
+		add("GRAPHQL_MAX_COST: must be positive, got %d", c.GraphQL.MaxCost)
+	}
+	if c.GraphQL.MaxSubscriptions <= 0 {
+		add("GRAPHQL_MAX_SUBSCRIPTIONS: must be positive, got %d", c.GraphQL.MaxSubscriptions)
+	}
+
+	return errs
+}
+
+func (c Config) Production() bool {
+	return c.Env == "production"
+}
+
+// dsnPassword matches the secret settings of a key=value connection string,
+// quoted or not.
+var dsnPassword = regexp.MustCompile(`\b((?:ssl)?password\s*=\s*)('(?:[^'\\]|\\.)*'|\S*)`)
+
+// Redacted returns a copy that is safe to print or log.
+func (c Config) Redacted() Config {
+	if c.AdminToken != "" {
+		c.AdminToken = "REDACTED"
+	}
+
+	// pgx also takes key=value strings, which url.Parse reads as a path.
+	if !strings.Contains(c.DB.URL, "://") {
+		c.DB.URL = dsnPassword.ReplaceAllString(c.DB.URL, "${1}REDACTED")
+		return c
+	}
+	u, err := url.Parse(c.DB.URL)
+	if err != nil {
+		c.DB.URL = "REDACTED"
+		return c
+	}
+
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "REDACTED")
+		}
+	}
+	q := u.Query()
+	for _, key := range []string{"password", "sslpassword"} {
+		if q.Has(key) {
+			q.Set(key, "REDACTED")
+		}
+	}
+	u.RawQuery = q.Encode()
+	c.DB.URL = u.String()
+	return c
+}
+
+// envReader applies set environment variables over the current values and
+// collects parse errors instead of stopping at the first one.
+type envReader struct {
+	errs *[]error
+}
+
+func (e envReader) str(key string, dst *string) {
+	if v, ok := os.LookupEnv(key); ok {
+		*dst = v
+	}
+}
+
+func (e envReader) integer(key string, dst *int) {
+	if v, ok := os.LookupEnv(key); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			*e.errs = append(*e.errs, fmt.Errorf("%s: %q is not an integer", key, v))
+			return
+		}
+		*dst = n
+	}
+}
+
+func (e envReader) boolean(key string, dst *bool) {
+	if v, ok := os.LookupEnv(key); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			*e.errs = append(*e.errs, fmt.Errorf("%s: %q is not a boolean", key, v))
+			return
+		}
+		*dst = b
+	}
+}
+
+func (e envReader) float(key string, dst *float64) {
+	if v, ok := os.LookupEnv(key); ok {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			*e.errs = append(*e.errs, fmt.Errorf("%s: %q is not a number", key, v))
+			return
+		}
+		*dst = f
+	}
+}
+
+func (e envReader) duration(key string, dst *time.Duration) {
+	if v, ok := os.LookupEnv(key); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			*e.errs = append(*e.errs, fmt.Errorf("%s: %q is not a duration (e.g. 90s, 5m, 3h)", key, v))
+			return
+		}
+		*dst = d
+	}
+}
+
+func (e envReader) seconds(key string, dst *time.Duration) {
+	var n int
+	if _, ok := os.LookupEnv(key); !ok {
+		return
+	}
+	before := len(*e.errs)
+	e.integer(key, &n)
+	if len(*e.errs) == before {
+		*dst = time.Duration(n) * time.Second
+	}
+}
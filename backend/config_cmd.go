@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/avnpl/go-march/config"
+	"gopkg.in/yaml.v3"
+)
+
+const configUsage = `usage: go-march config <command>
+
+commands:
+  print    print the effective configuration with secrets redacted`
+
+// runConfig handles the config subcommand and returns the exit code. It runs
+// before anything connects so that a broken configuration can be inspected.
+func runConfig(cfg config.Config, loadErr error, args []string) int {
+	if len(args) != 1 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, configUsage)
+		return 2
+	}
+
+	out, err := yaml.Marshal(cfg.Redacted())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Print(string(out))
+
+	if loadErr != nil {
+		fmt.Fprintln(os.Stderr, loadErr)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,77 @@
+package events
+
+import (
+	"sync"
+
+	"github.com/avnpl/go-march/models"
+	"go.uber.org/zap"
+)
+
+type Topic string
+
+const (
+	// ProductUpdated carries the product after an update or a stock change.
+	ProductUpdated Topic = "product.updated"
+	// StockChanged carries the product after its stock was set or an order
+	// took from it.
+	StockChanged Topic = "product.stock_changed"
+	// OrderStatusChanged carries the order with its new status.
+	OrderStatusChanged Topic = "order.status_changed"
+)
+
+// subscriberBuffer is how many events a slow subscriber may fall behind
+// before it starts missing them.
+const subscriberBuffer = 64
+
+type Event struct {
+	Topic   Topic
+	Product models.Product
+	Order   models.Orders
+}
+
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[chan Event]struct{}
+	log  *zap.Logger
+}
+
+func NewBus(log *zap.Logger) *Bus {
+	return &Bus{subs: make(map[chan Event]struct{}), log: log}
+}
+
+// Publish hands e to every subscriber without waiting, so a write never blocks
+// on a slow client; a subscriber with a full buffer misses the event. A nil
+// bus drops everything.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			b.log.Warn("dropped event for slow subscriber", zap.String("topic", string(e.Topic)))
+		}
+	}
+}
+
+// Subscribe returns every event published from now on, until the returned
+// function is called.
+func (b *Bus) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
@@ -2,9 +2,7 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
-	"io"
 	"log"
 	"net/http"
 	"os"
@@ -13,37 +11,97 @@ import (
 	"time"
 
 	gql "github.com/avnpl/go-march/api/graphql"
+	"github.com/avnpl/go-march/api/middleware"
 	"github.com/avnpl/go-march/api/rest"
 	"github.com/go-playground/validator/v10"
-	"github.com/graphql-go/graphql"
-	"github.com/joho/godotenv"
+	"github.com/jmoiron/sqlx"
 
+	"github.com/avnpl/go-march/config"
+	"github.com/avnpl/go-march/events"
+	"github.com/avnpl/go-march/metrics"
+	"github.com/avnpl/go-march/migrate"
 	"github.com/avnpl/go-march/repos"
 	"github.com/avnpl/go-march/services"
+	"github.com/avnpl/go-march/tracing"
 	"github.com/avnpl/go-march/utils"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"go.uber.org/zap"
 )
 
+const healthCheckTimeout = 2 * time.Second
+
 func main() {
-	err := godotenv.Load(".env")
+	cfg, err := config.Load()
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfig(cfg, err, os.Args[2:]))
+	}
 	if err != nil {
-		log.Fatalln("Error loading .env file...")
+		log.Fatalln(err)
 	}
 
-	logger := utils.BuildLogger()
+	logger, logLevel := utils.BuildLogger(cfg.Env, cfg.Log)
 	defer logger.Sync()
 
-	db := utils.GetDBPoolObject(logger)
+	db := utils.GetDBPoolObject(cfg.DB, logger)
 	defer db.Close()
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(context.Background(), db, cfg.DB.Dialect, logger, os.Args[2:]); err != nil {
+			logger.Fatal("migrate failed", zap.Error(err))
+		}
+		return
+	}
+
+	if cfg.DB.AutoMigrate {
+		if err := autoMigrate(context.Background(), db, cfg.DB.Dialect, logger); err != nil {
+			logger.Fatal("auto-migrate failed", zap.Error(err))
+		}
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Env, cfg.Tracing)
+	if err != nil {
+		logger.Fatal("failed to set up tracing", zap.Error(err))
+	}
+
 	validate := validator.New(validator.WithRequiredStructEnabled())
+	validate.RegisterTagNameFunc(utils.JSONFieldName)
+	ttl := cfg.TTL.Duration
+
+	reaperCtx, stopReaper := context.WithCancel(context.Background())
+	defer stopReaper()
+	if runReaper(context.Background(), db, cfg, logger) {
+		reaper := services.NewTTLReaper(repos.NewPGTTLRepo(db), cfg.TTL.ReapInterval, logger)
+		go reaper.Run(reaperCtx)
+	}
 
 	// Initialize the layers
+	bus := events.NewBus(logger)
+	currencyService := services.NewCurrencyService(repos.NewPGCurrencyRepo(db), logger)
+	currencyHandler := rest.NewCurrencyHandler(currencyService, logger)
 	productRepo := repos.NewPGProductRepo(db)
-	productService := services.NewProductService(productRepo, logger)
-	productHandler := rest.NewProductHandler(productService, logger, validate)
+	productService := services.NewProductService(productRepo, ttl, bus, logger)
+	productHandler := rest.NewProductHandler(productService, currencyService, logger, validate)
+	orderRepo := repos.NewPGOrderRepo(db)
+	orderService := services.NewOrderService(orderRepo, productRepo, ttl, bus, logger)
+	orderHandler := rest.NewOrderHandler(orderService, currencyService, logger, validate)
+	cardVault := services.NewCardVault(repos.NewPGCardRepo(db), ttl, logger)
+	cardHandler := rest.NewCardHandler(cardVault, logger, validate)
+	paymentRepo := repos.NewPGPaymentRepo(db)
+	paymentService := services.NewPaymentService(paymentRepo, orderRepo, cardVault, ttl, bus, logger)
+	paymentHandler := rest.NewPaymentHandler(paymentService, logger, validate)
+	adminHandler := rest.NewAdminHandler(logLevel, cfg.AdminToken, currencyService, logger, validate)
+	appMetrics := metrics.New(db.DB)
+
+	migrator, err := newMigrator(context.Background(), db, cfg.DB.Dialect, logger)
+	if err != nil {
+		logger.Fatal("failed to load migrations", zap.Error(err))
+	}
+	healthService := services.NewHealthService(healthCheckTimeout,
+		services.HealthCheck{Name: "database", Check: db.PingContext},
+		services.HealthCheck{Name: "migrations", Check: migrator.CheckLatest},
+	)
+	healthHandler := rest.NewHealthHandler(healthService, logger)
 
 	// Set up the HTTP server
 	mux := http.NewServeMux()
@@ -70,64 +128,91 @@ func main() {
 			productHandler.DeleteProduct(w, r)
 		case http.MethodGet:
 			productHandler.FetchProduct(w, r)
+		case http.MethodPatch:
+			productHandler.UpdateProduct(w, r)
 		default:
 			utils.SendJSONError(w, http.StatusMethodNotAllowed, "Invalid HTTP Method")
 		}
 	})
-
-	if err := gql.NewSchema(productService); err != nil {
-		logger.Fatal("failed to instantiate GraphQL Schema", zap.Error(err))
-	}
-
-	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
-
-		if r.Method != http.MethodPost {
+	mux.HandleFunc("/orders", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			orderHandler.FetchAllOrders(w, r)
+		case http.MethodPost:
+			orderHandler.CreateOrder(w, r)
+		default:
 			utils.SendJSONError(w, http.StatusMethodNotAllowed, "Invalid HTTP Method")
-			return
 		}
-
-		bodyBytes, err := io.ReadAll(r.Body)
-		if err != nil {
-			utils.SendInternalError(w)
-			return
+	})
+	mux.HandleFunc("/orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			orderHandler.FetchOrder(w, r)
+		case http.MethodPatch:
+			orderHandler.UpdateOrder(w, r)
+		default:
+			utils.SendJSONError(w, http.StatusMethodNotAllowed, "Invalid HTTP Method")
 		}
-		logger.Debug("graphql body", zap.String("body", string(bodyBytes)))
-
-		var params struct {
-			Query string `json:"query"`
+	})
+	mux.HandleFunc("/cards", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			cardHandler.TokenizeCard(w, r)
+		} else {
+			utils.SendJSONError(w, http.StatusMethodNotAllowed, "Invalid HTTP Method")
 		}
-		err = json.Unmarshal(bodyBytes, &params)
-		if err != nil {
-			logger.Error("failed to decode GraphQL request", zap.Error(err))
-			utils.SendJSONError(w, http.StatusBadRequest, "Invalid Request")
-			return
+	})
+	mux.HandleFunc("/payments", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			paymentHandler.CreatePayment(w, r)
+		} else {
+			utils.SendJSONError(w, http.StatusMethodNotAllowed, "Invalid HTTP Method")
 		}
-
-		if params.Query == "" {
-			utils.SendJSONError(w, http.StatusBadRequest, "Query cannot be empty")
-			return
+	})
+	mux.HandleFunc("/payments/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			paymentHandler.FetchPayment(w, r)
+		} else {
+			utils.SendJSONError(w, http.StatusMethodNotAllowed, "Invalid HTTP Method")
 		}
+	})
 
-		result := graphql.Do(graphql.Params{
-			Schema:        gql.Schema,
-			RequestString: params.Query,
-			Context:       r.Context(),
-		})
+	mux.HandleFunc("GET /currencies", currencyHandler.FetchCurrencies)
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		_ = json.NewEncoder(w).Encode(result)
-	})
+	mux.HandleFunc("/admin/log-level", adminHandler.LogLevel)
+	mux.HandleFunc("PUT /admin/currencies/{code}", adminHandler.SaveCurrency)
+	mux.HandleFunc("GET /admin/exchange-rates", adminHandler.FetchRates)
+	mux.HandleFunc("PUT /admin/exchange-rates/{base}/{quote}", adminHandler.SetRate)
+	mux.HandleFunc("DELETE /admin/exchange-rates/{base}/{quote}", adminHandler.DeleteRate)
+	mux.Handle("/metrics", appMetrics.Handler())
+	mux.HandleFunc("GET /livez", healthHandler.Livez)
+	mux.HandleFunc("GET /readyz", healthHandler.Readyz)
+	mux.HandleFunc("GET /health", healthHandler.Health)
+
+	if err := gql.NewSchema(productService, orderService, currencyService, bus, logger, validate); err != nil {
+		logger.Fatal("failed to instantiate GraphQL Schema", zap.Error(err))
+	}
+
+	gqlHandler := gql.NewHandler(appMetrics, cfg.GraphQL, logger)
+	mux.Handle("/graphql", gqlHandler)
 
-	port := utils.GetEnvVarString("PORT", ":8013", logger)
+	port := cfg.Port
 
 	srv := &http.Server{
-		Addr:         port,
-		Handler:      mux,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  120 * time.Second,
+		Addr: port,
+		Handler: middleware.Chain(mux,
+			middleware.RequestID(logger),
+			middleware.Trace(logger),
+			middleware.AccessLog(logger),
+			middleware.Metrics(appMetrics),
+			middleware.Recover(logger),
+		),
+		ReadTimeout:  cfg.HTTP.ReadTimeout,
+		WriteTimeout: cfg.HTTP.WriteTimeout,
+		IdleTimeout:  cfg.HTTP.IdleTimeout,
 	}
+	// Shutdown does not wait for hijacked connections, so say goodbye to
+	// subscribers ourselves.
+	srv.RegisterOnShutdown(gqlHandler.CloseSubscriptions)
 
 	// Start the server in a separate GR
 	go func() {
@@ -142,9 +227,37 @@ func main() {
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 	<-stop
 	logger.Info("Shutting down")
+	healthService.StartDraining()
+	if cfg.HTTP.DrainDelay > 0 {
+		logger.Info("draining before shutdown", zap.Duration("delay", cfg.HTTP.DrainDelay))
+		time.Sleep(cfg.HTTP.DrainDelay)
+	}
+	stopReaper()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
 	defer cancel()
 	srv.Shutdown(ctx)
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Error("failed to flush traces", zap.Error(err))
+	}
 	logger.Info("goodbye")
 }
+
+// runReaper decides from TTL_REAPER (auto, on, off) whether expired rows are
+// deleted in-process. In auto mode that happens only when the database has no
+// native row TTL.
+func runReaper(ctx context.Context, db *sqlx.DB, cfg config.Config, logger *zap.Logger) bool {
+	switch cfg.TTL.Reaper {
+	case "on":
+		return true
+	case "auto":
+		dialect, err := dbDialect(ctx, db, cfg.DB.Dialect)
+		if err != nil {
+			logger.Error("cannot detect database dialect, ttl reaper disabled", zap.Error(err))
+			return false
+		}
+		return dialect != migrate.Cockroach
+	default:
+		return false
+	}
+}
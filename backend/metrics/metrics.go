@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// GraphQL operation names come from clients, so only this many distinct names
+// get their own label value; the rest are counted as "other".
+const maxOperationNames = 200
+
+var operationNamePattern = regexp.MustCompile(`^[_A-Za-z][_0-9A-Za-z]{0,63}$`)
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests  *prometheus.CounterVec
+	httpDuration  *prometheus.HistogramVec
+	gqlOperations *prometheus.CounterVec
+	gqlErrors     *prometheus.CounterVec
+
+	mu             sync.Mutex
+	operationNames map[string]bool
+}
+
+// New registers the HTTP, GraphQL, connection pool (for db) and Go runtime
+// collectors on a registry of their own.
+func New(db *sql.DB) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests by method, route pattern and status code.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request latency by method, route pattern and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		gqlOperations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "graphql_operations_total",
+			Help: "GraphQL operations by operation name and type.",
+		}, []string{"operation", "type"}),
+		gqlErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "graphql_errors_total",
+			Help: "Errors returned in GraphQL responses by operation name and type.",
+		}, []string{"operation", "type"}),
+		operationNames: make(map[string]bool),
+	}
+
+	m.registry.MustRegister(
+		m.httpRequests,
+		m.httpDuration,
+		m.gqlOperations,
+		m.gqlErrors,
+		collectors.NewDBStatsCollector(db, "go_march"),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Handler serves the registry in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+func (m *Metrics) ObserveHTTP(method string, route string, status int, elapsed time.Duration) {
+	method = methodLabel(method)
+	code := strconv.Itoa(status)
+	m.httpRequests.WithLabelValues(method, route, code).Inc()
+	m.httpDuration.WithLabelValues(method, route, code).Observe(elapsed.Seconds())
+}
+
+func (m *Metrics) ObserveGraphQL(operation string, opType string, errors int) {
+	operation = m.operationLabel(operation)
+	if opType == "" {
+		opType = "unknown"
+	}
+
+	m.gqlOperations.WithLabelValues(operation, opType).Inc()
+	if errors > 0 {
+		m.gqlErrors.WithLabelValues(operation, opType).Add(float64(errors))
+	}
+}
+
+// methodLabel keeps the label set bounded, the method is whatever the client
+// sent.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	default:
+		return "OTHER"
+	}
+}
+
+func (m *Metrics) operationLabel(name string) string {
+	if name == "" {
+		return "anonymous"
+	}
+	if !operationNamePattern.MatchString(name) {
+		return "other"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.operationNames[name] {
+		return name
+	}
+	if len(m.operationNames) >= maxOperationNames {
+		return "other"
+	}
+	m.operationNames[name] = true
+	return name
+}
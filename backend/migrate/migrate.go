@@ -0,0 +1,484 @@
+package migrate
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// Files that start with this line are applied statement by statement outside a
+// transaction. CockroachDB does not allow some schema changes (e.g. adding a
+// column and then writing to it) inside a single transaction.
+const noTxDirective = "-- migrate:no-transaction"
+
+// Shared files are NNN_name.up.sql. A NNN_name.<dialect>.up.sql file replaces
+// the shared one for that dialect and is ignored by the others.
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(\w+?)(?:\.(cockroach|postgres))?\.(up|down)\.sql$`)
+
+// lockKey is the Postgres advisory lock every replica takes before migrating.
+const lockKey = 7_281_956_204
+
+var (
+	ErrNoDownMigration = errors.New("migration has no down file")
+	ErrSchemaOutdated  = errors.New("schema is not at the latest migration")
+	ErrLockNeedsConn   = errors.New("migrating needs at least 2 database connections, one holds the lock")
+)
+
+type Dialect string
+
+const (
+	Cockroach Dialect = "cockroach"
+	Postgres  Dialect = "postgres"
+)
+
+// DetectDialect asks the server which database it is, CockroachDB reports
+// itself in version().
+func DetectDialect(ctx context.Context, db *sqlx.DB) (Dialect, error) {
+	var version string
+	if err := db.GetContext(ctx, &version, "select version()"); err != nil {
+		return "", fmt.Errorf("migrate.DetectDialect: %w", err)
+	}
+	if strings.Contains(version, "CockroachDB") {
+		return Cockroach, nil
+	}
+	return Postgres, nil
+}
+
+func ParseDialect(s string) (Dialect, error) {
+	switch d := Dialect(strings.ToLower(s)); d {
+	case Cockroach, Postgres:
+		return d, nil
+	case "postgresql":
+		return Postgres, nil
+	case "cockroachdb", "crdb":
+		return Cockroach, nil
+	default:
+		return "", fmt.Errorf("unknown database dialect %q", s)
+	}
+}
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Version   int64      `db:"version"`
+	Name      string     `db:"name"`
+	AppliedAt *time.Time `db:"applied_at"`
+}
+
+type Migrator struct {
+	db         *sqlx.DB
+	log        *zap.Logger
+	dialect    Dialect
+	migrations []Migration
+}
+
+func New(db *sqlx.DB, fsys fs.FS, dialect Dialect, log *zap.Logger) (*Migrator, error) {
+	migrations, err := load(fsys, dialect)
+	if err != nil {
+		return nil, fmt.Errorf("migrate.New: %w", err)
+	}
+	return &Migrator{db: db, log: log, dialect: dialect, migrations: migrations}, nil
+}
+
+func (m *Migrator) Dialect() Dialect {
+	return m.dialect
+}
+
+// Latest is the version the schema is at once every migration is applied.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version returns the highest applied version, 0 for an empty database.
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return 0, fmt.Errorf("migrate.Version: %w", err)
+	}
+
+	var version int64
+	err := m.db.GetContext(ctx, &version, "select coalesce(max(version), 0) from schema_migrations")
+	if err != nil {
+		return 0, fmt.Errorf("migrate.Version: %w", err)
+	}
+	return version, nil
+}
+
+// CheckLatest reports whether every migration has been applied. Unlike Version
+// it never creates the bookkeeping table, so it is cheap enough for probes.
+func (m *Migrator) CheckLatest(ctx context.Context) error {
+	var version int64
+	err := m.db.GetContext(ctx, &version, "select coalesce(max(version), 0) from schema_migrations")
+	if err != nil {
+		return fmt.Errorf("migrate.CheckLatest: %w", err)
+	}
+	if version != m.Latest() {
+		return fmt.Errorf("migrate.CheckLatest: at version %d, expected %d: %w", version, m.Latest(), ErrSchemaOutdated)
+	}
+	return nil
+}
+
+// Up applies up to steps pending migrations in version order, all of them when
+// steps is 0.
+func (m *Migrator) Up(ctx context.Context, steps int) ([]Migration, error) {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("migrate.Up: %w", err)
+	}
+	defer unlock()
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("migrate.Up: %w", err)
+	}
+
+	var done []Migration
+	for _, mig := range m.migrations {
+		if steps > 0 && len(done) == steps {
+			break
+		}
+		if applied[mig.Version] {
+			continue
+		}
+
+		const record = "insert into schema_migrations (version, name) values ($1, $2)"
+		if err := m.run(ctx, mig.Up, record, mig.Version, mig.Name); err != nil {
+			return done, fmt.Errorf("migrate.Up: %03d_%s: %w", mig.Version, mig.Name, err)
+		}
+		m.log.Info("applied migration", zap.Int64("version", mig.Version), zap.String("name", mig.Name))
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+// Down reverts the last steps applied migrations, newest first.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("migrate.Down: %w", err)
+	}
+	defer unlock()
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("migrate.Down: %w", err)
+	}
+
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		mig := m.migrations[i]
+		if !applied[mig.Version] {
+			continue
+		}
+		if mig.Down == "" {
+			return done, fmt.Errorf("migrate.Down: %03d_%s: %w", mig.Version, mig.Name, ErrNoDownMigration)
+		}
+
+		const record = "delete from schema_migrations where version = $1"
+		if err := m.run(ctx, mig.Down, record, mig.Version); err != nil {
+			return done, fmt.Errorf("migrate.Down: %03d_%s: %w", mig.Version, mig.Name, err)
+		}
+		m.log.Info("reverted migration", zap.Int64("version", mig.Version), zap.String("name", mig.Name))
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+// Force records every migration up to version as applied without running it,
+// for databases whose schema was created by hand before the runner existed.
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return fmt.Errorf("migrate.Force: %w", err)
+	}
+	defer unlock()
+
+	if err := m.ensureTable(ctx); err != nil {
+		return fmt.Errorf("migrate.Force: %w", err)
+	}
+
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("migrate.Force: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "delete from schema_migrations"); err != nil {
+		return fmt.Errorf("migrate.Force: %w", err)
+	}
+	for _, mig := range m.migrations {
+		if mig.Version > version {
+			break
+		}
+		_, err := tx.ExecContext(ctx, "insert into schema_migrations (version, name) values ($1, $2)", mig.Version, mig.Name)
+		if err != nil {
+			return fmt.Errorf("migrate.Force: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("migrate.Force: %w", err)
+	}
+	return nil
+}
+
+// Status lists every known migration, AppliedAt is nil for pending ones.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, fmt.Errorf("migrate.Status: %w", err)
+	}
+
+	var rows []Status
+	if err := m.db.SelectContext(ctx, &rows, "select version, name, applied_at from schema_migrations"); err != nil {
+		return nil, fmt.Errorf("migrate.Status: %w", err)
+	}
+	appliedAt := make(map[int64]*time.Time, len(rows))
+	for _, row := range rows {
+		appliedAt[row.Version] = row.AppliedAt
+	}
+
+	res := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		res = append(res, Status{Version: mig.Version, Name: mig.Name, AppliedAt: appliedAt[mig.Version]})
+	}
+	return res, nil
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	const query = `create table if not exists schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`
+
+	_, err := m.db.ExecContext(ctx, query)
+	return err
+}
+
+// lock waits until no other replica is migrating and keeps them out until
+// unlock is called. It holds one connection of the pool meanwhile, the
+// migrations run on the others.
+func (m *Migrator) lock(ctx context.Context) (unlock func(), err error) {
+	if m.db.Stats().MaxOpenConnections == 1 {
+		return nil, ErrLockNeedsConn
+	}
+
+	if m.dialect == Postgres {
+		conn, err := m.db.Connx(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := conn.ExecContext(ctx, "select pg_advisory_lock($1)", lockKey); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return func() {
+			// The lock belongs to the session, so it must be released before
+			// the connection goes back to the pool, even once ctx is done.
+			if _, err := conn.ExecContext(context.Background(), "select pg_advisory_unlock($1)", lockKey); err != nil {
+				m.log.Warn("releasing the migration lock failed", zap.Error(err))
+				// Discard the connection instead, ending the session and the lock.
+				conn.Raw(func(any) error { return driver.ErrBadConn })
+			}
+			conn.Close()
+		}, nil
+	}
+
+	// CockroachDB accepts advisory locks but does not enforce them. A row
+	// locked by a transaction left open does the same, and goes away with the
+	// transaction if the process dies.
+	const create = "create table if not exists schema_migrations_lock (id INT8 PRIMARY KEY)"
+	if _, err := m.db.ExecContext(ctx, create); err != nil {
+		return nil, err
+	}
+	if _, err := m.db.ExecContext(ctx, "insert into schema_migrations_lock (id) values (1) on conflict (id) do nothing"); err != nil {
+		return nil, err
+	}
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, "select id from schema_migrations_lock where id = 1 for update"); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return func() { tx.Rollback() }, nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int64]bool, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	var versions []int64
+	if err := m.db.SelectContext(ctx, &versions, "select version from schema_migrations"); err != nil {
+		return nil, err
+	}
+	res := make(map[int64]bool, len(versions))
+	for _, v := range versions {
+		res[v] = true
+	}
+	return res, nil
+}
+
+// run executes the statements of one file followed by the bookkeeping
+// statement, inside one transaction unless the file opts out.
+func (m *Migrator) run(ctx context.Context, script string, record string, args ...interface{}) error {
+	statements := splitStatements(script)
+
+	if strings.HasPrefix(strings.TrimSpace(script), noTxDirective) {
+		for _, stmt := range statements {
+			if _, err := m.db.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		_, err := m.db.ExecContext(ctx, record, args...)
+		return err
+	}
+
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func load(fsys fs.FS, dialect Dialect) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	type file struct {
+		body     string
+		specific bool
+	}
+	byVersion := make(map[int64]*Migration)
+	files := make(map[string]file)
+
+	for _, e := range entries {
+		match := fileNamePattern.FindStringSubmatch(e.Name())
+		if e.IsDir() || match == nil {
+			continue
+		}
+		if match[3] != "" && Dialect(match[3]) != dialect {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Name(), err)
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = mig
+		} else if mig.Name != match[2] {
+			return nil, fmt.Errorf("version %d is used by %s and %s", version, mig.Name, match[2])
+		}
+
+		key := fmt.Sprintf("%d.%s", version, match[4])
+		if prev, ok := files[key]; ok && prev.specific && match[3] == "" {
+			continue
+		}
+		body, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		files[key] = file{body: string(body), specific: match[3] != ""}
+	}
+
+	res := make([]Migration, 0, len(byVersion))
+	for version, mig := range byVersion {
+		mig.Up = files[fmt.Sprintf("%d.up", version)].body
+		mig.Down = files[fmt.Sprintf("%d.down", version)].body
+		if mig.Up == "" {
+			return nil, fmt.Errorf("version %d (%s) has no up file for %s", mig.Version, mig.Name, dialect)
+		}
+		res = append(res, *mig)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Version < res[j].Version })
+	return res, nil
+}
+
+// splitStatements splits a script on semicolons that are outside of quoted
+// strings and $$ bodies, and drops comment-only and empty statements.
+func splitStatements(script string) []string {
+	var res []string
+	var current strings.Builder
+	inQuote, inDollar := false, false
+
+	flush := func() {
+		stmt := strings.TrimSpace(current.String())
+		current.Reset()
+		if stripComments(stmt) != "" {
+			res = append(res, stmt)
+		}
+	}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case !inQuote && c == '$' && strings.HasPrefix(script[i:], "$$"):
+			inDollar = !inDollar
+			current.WriteString("$$")
+			i++
+			continue
+		case inDollar:
+		case c == '\'':
+			inQuote = !inQuote
+		case !inQuote && c == '-' && i+1 < len(script) && script[i+1] == '-':
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				end = len(script) - i
+			}
+			current.WriteString(script[i : i+end])
+			i += end - 1
+			continue
+		case !inQuote && c == ';':
+			flush()
+			continue
+		}
+		current.WriteByte(c)
+	}
+	flush()
+	return res
+}
+
+func stripComments(stmt string) string {
+	var lines []string
+	for _, line := range strings.Split(stmt, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
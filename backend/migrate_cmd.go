@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/avnpl/go-march/migrate"
+	"github.com/avnpl/go-march/migrations"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const migrateUsage = `usage: go-march migrate <command>
+
+commands:
+  up [n]       apply all (or the next n) pending migrations
+  down [n]     revert the last n applied migrations (default 1)
+  status       list migrations and when they were applied
+  version      print the current schema version
+  force <v>    mark migrations up to v as applied without running them`
+
+var errMigrateUsage = errors.New("invalid migrate command")
+
+func runMigrate(ctx context.Context, db *sqlx.DB, dialect string, logger *zap.Logger, args []string) error {
+	m, err := newMigrator(ctx, db, dialect, logger)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return errMigrateUsage
+	}
+
+	switch args[0] {
+	case "up":
+		steps, err := migrateSteps(args[1:], 0)
+		if err != nil {
+			return err
+		}
+		done, err := m.Up(ctx, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("applied %d migration(s)\n", len(done))
+	case "down":
+		steps, err := migrateSteps(args[1:], 1)
+		if err != nil {
+			return err
+		}
+		done, err := m.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("reverted %d migration(s)\n", len(done))
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%03d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		tw.Flush()
+	case "version":
+		version, err := m.Version(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d (latest %d, %s)\n", version, m.Latest(), m.Dialect())
+	case "force":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return errMigrateUsage
+		}
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		if err := m.Force(ctx, version); err != nil {
+			return err
+		}
+		fmt.Printf("schema marked at version %d\n", version)
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return errMigrateUsage
+	}
+	return nil
+}
+
+func migrateSteps(args []string, defaultSteps int) (int, error) {
+	if len(args) == 0 {
+		return defaultSteps, nil
+	}
+	steps, err := strconv.Atoi(args[0])
+	if err != nil || steps < 1 {
+		return 0, fmt.Errorf("invalid step count %q", args[0])
+	}
+	return steps, nil
+}
+
+// autoMigrate brings the schema up to date before the server starts serving.
+func autoMigrate(ctx context.Context, db *sqlx.DB, dialect string, logger *zap.Logger) error {
+	m, err := newMigrator(ctx, db, dialect, logger)
+	if err != nil {
+		return err
+	}
+	done, err := m.Up(ctx, 0)
+	if err != nil {
+		return err
+	}
+	logger.Info("schema up to date",
+		zap.Int("applied", len(done)),
+		zap.Int64("version", m.Latest()),
+		zap.String("dialect", string(m.Dialect())),
+	)
+	return nil
+}
+
+// newMigrator picks the migration set for the dialect of the database.
+func newMigrator(ctx context.Context, db *sqlx.DB, configured string, logger *zap.Logger) (*migrate.Migrator, error) {
+	dialect, err := dbDialect(ctx, db, configured)
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(db, migrations.FS, dialect, logger)
+}
+
+// dbDialect is the configured DB_DIALECT, or whatever the server reports itself
+// as when that is not set.
+func dbDialect(ctx context.Context, db *sqlx.DB, configured string) (migrate.Dialect, error) {
+	if configured != "" {
+		return migrate.ParseDialect(configured)
+	}
+	return migrate.DetectDialect(ctx, db)
+}
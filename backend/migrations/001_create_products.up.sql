@@ -1,11 +1,11 @@
 -- Create products table with string IDs
 CREATE TABLE IF NOT EXISTS products (
-    prod_id STRING PRIMARY KEY,
+    prod_id TEXT PRIMARY KEY,
     prod_name VARCHAR(100) NOT NULL,
     price DECIMAL(10, 2) NOT NULL,
     stock INT8 NOT NULL DEFAULT 0,
-    created_at TIMESTAMPTZ NOT NULL DEFAULT now():::TIMESTAMPTZ,
-    updated_at TIMESTAMPTZ NOT NULL DEFAULT now():::TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
     ttl_expires_at TIMESTAMPTZ
 );
 
@@ -1,11 +1,11 @@
 -- Create orders table with string IDs
 CREATE TABLE IF NOT EXISTS orders (
-    order_id STRING PRIMARY KEY,
-    product_id STRING NOT NULL,
+    order_id TEXT PRIMARY KEY,
+    product_id TEXT NOT NULL,
     quantity INT8 NOT NULL,
     total_price DECIMAL(10, 2) NOT NULL,
-    order_time TIMESTAMPTZ NOT NULL DEFAULT now():::TIMESTAMPTZ,
-    status STRING DEFAULT 'pending',
+    order_time TIMESTAMPTZ NOT NULL DEFAULT now(),
+    status TEXT DEFAULT 'pending',
     shipping_address TEXT,
     notes TEXT,
     ttl_expires_at TIMESTAMPTZ,
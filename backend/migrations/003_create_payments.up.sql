@@ -1,12 +1,12 @@
 -- Create payments table with string IDs
 CREATE TABLE IF NOT EXISTS payments (
-    payment_id STRING PRIMARY KEY,
-    order_id STRING NOT NULL,
+    payment_id TEXT PRIMARY KEY,
+    order_id TEXT NOT NULL,
     amount DECIMAL(10, 2) NOT NULL,
-    status STRING DEFAULT 'pending',
-    card_number STRING,
-    card_last_four STRING,
-    created_at TIMESTAMPTZ DEFAULT now():::TIMESTAMPTZ,
+    status TEXT DEFAULT 'pending',
+    card_number TEXT,
+    card_last_four TEXT,
+    created_at TIMESTAMPTZ DEFAULT now(),
     ttl_expires_at TIMESTAMPTZ,
     CONSTRAINT payments_order_id_fkey FOREIGN KEY (order_id) REFERENCES orders(order_id)
 );
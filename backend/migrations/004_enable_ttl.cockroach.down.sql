@@ -0,0 +1,4 @@
+-- migrate:no-transaction
+ALTER TABLE payments RESET (ttl_expiration_expression);
+ALTER TABLE orders RESET (ttl_expiration_expression);
+ALTER TABLE products RESET (ttl_expiration_expression);
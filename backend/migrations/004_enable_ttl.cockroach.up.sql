@@ -1,3 +1,4 @@
+-- migrate:no-transaction
 -- Enable TTL using custom column (ttl_expires_at)
 -- Rows will be deleted when current time > ttl_expires_at
 -- Sample data has ttl_expires_at = NULL (never expires)
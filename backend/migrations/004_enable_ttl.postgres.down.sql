@@ -0,0 +1,9 @@
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_cron') THEN
+        PERFORM cron.unschedule(jobid) FROM cron.job WHERE jobname = 'ttl-delete-expired';
+    END IF;
+END
+$$;
+
+DROP FUNCTION IF EXISTS ttl_delete_expired();
@@ -0,0 +1,42 @@
+-- PostgreSQL has no row-level TTL, expired rows are removed by ttl_delete_expired()
+-- Rows whose parent expired go with it so the foreign keys never block a delete
+-- Sample data has ttl_expires_at = NULL (never expires)
+
+CREATE OR REPLACE FUNCTION ttl_delete_expired() RETURNS BIGINT
+LANGUAGE plpgsql AS $$
+DECLARE
+    deleted BIGINT := 0;
+    n BIGINT;
+BEGIN
+    DELETE FROM payments
+    WHERE ttl_expires_at <= now()
+       OR order_id IN (
+           SELECT order_id FROM orders
+           WHERE ttl_expires_at <= now()
+              OR product_id IN (SELECT prod_id FROM products WHERE ttl_expires_at <= now())
+       );
+    GET DIAGNOSTICS n = ROW_COUNT;
+    deleted := deleted + n;
+
+    DELETE FROM orders
+    WHERE ttl_expires_at <= now()
+       OR product_id IN (SELECT prod_id FROM products WHERE ttl_expires_at <= now());
+    GET DIAGNOSTICS n = ROW_COUNT;
+    deleted := deleted + n;
+
+    DELETE FROM products WHERE ttl_expires_at <= now();
+    GET DIAGNOSTICS n = ROW_COUNT;
+    deleted := deleted + n;
+
+    RETURN deleted;
+END
+$$;
+
+-- Schedule the cleanup when pg_cron is installed, otherwise call it periodically
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_cron') THEN
+        PERFORM cron.schedule('ttl-delete-expired', '*/5 * * * *', 'SELECT ttl_delete_expired()');
+    END IF;
+END
+$$;
@@ -0,0 +1,7 @@
+-- migrate:no-transaction
+-- Card numbers are not recoverable, the restored column stays empty
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS card_number TEXT;
+ALTER TABLE payments DROP COLUMN IF EXISTS card_brand;
+ALTER TABLE payments DROP COLUMN IF EXISTS card_token;
+
+DROP TABLE IF EXISTS card_tokens;
@@ -0,0 +1,2 @@
+-- migrate:no-transaction
+ALTER TABLE card_tokens RESET (ttl_expiration_expression);
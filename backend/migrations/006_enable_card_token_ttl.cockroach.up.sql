@@ -0,0 +1,2 @@
+-- migrate:no-transaction
+ALTER TABLE card_tokens SET (ttl_expiration_expression = 'ttl_expires_at');
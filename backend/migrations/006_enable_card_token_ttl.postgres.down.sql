@@ -0,0 +1,30 @@
+-- Restore the 004 version of ttl_delete_expired()
+CREATE OR REPLACE FUNCTION ttl_delete_expired() RETURNS BIGINT
+LANGUAGE plpgsql AS $$
+DECLARE
+    deleted BIGINT := 0;
+    n BIGINT;
+BEGIN
+    DELETE FROM payments
+    WHERE ttl_expires_at <= now()
+       OR order_id IN (
+           SELECT order_id FROM orders
+           WHERE ttl_expires_at <= now()
+              OR product_id IN (SELECT prod_id FROM products WHERE ttl_expires_at <= now())
+       );
+    GET DIAGNOSTICS n = ROW_COUNT;
+    deleted := deleted + n;
+
+    DELETE FROM orders
+    WHERE ttl_expires_at <= now()
+       OR product_id IN (SELECT prod_id FROM products WHERE ttl_expires_at <= now());
+    GET DIAGNOSTICS n = ROW_COUNT;
+    deleted := deleted + n;
+
+    DELETE FROM products WHERE ttl_expires_at <= now();
+    GET DIAGNOSTICS n = ROW_COUNT;
+    deleted := deleted + n;
+
+    RETURN deleted;
+END
+$$;
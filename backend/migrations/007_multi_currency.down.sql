@@ -0,0 +1,7 @@
+-- migrate:no-transaction
+ALTER TABLE payments DROP COLUMN IF EXISTS currency;
+ALTER TABLE orders DROP COLUMN IF EXISTS currency;
+ALTER TABLE products DROP COLUMN IF EXISTS currency;
+
+DROP TABLE IF EXISTS exchange_rates;
+DROP TABLE IF EXISTS currencies;
@@ -0,0 +1,42 @@
+-- migrate:no-transaction
+-- Currencies and the exchange rates between them, managed through /admin
+CREATE TABLE IF NOT EXISTS currencies (
+    code TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    minor_units INT8 NOT NULL DEFAULT 2,
+    CONSTRAINT currencies_code_check CHECK (code ~ '^[A-Z]{3}$'),
+    CONSTRAINT currencies_minor_units_check CHECK (minor_units BETWEEN 0 AND 2)
+);
+
+INSERT INTO currencies (code, name, minor_units) VALUES
+    ('USD', 'US Dollar', 2),
+    ('EUR', 'Euro', 2),
+    ('GBP', 'Pound Sterling', 2),
+    ('INR', 'Indian Rupee', 2),
+    ('JPY', 'Japanese Yen', 0)
+ON CONFLICT (code) DO NOTHING;
+
+-- One unit of base_code is worth rate units of quote_code
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    base_code TEXT NOT NULL,
+    quote_code TEXT NOT NULL,
+    rate DECIMAL(18, 8) NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (base_code, quote_code),
+    CONSTRAINT exchange_rates_base_code_fkey FOREIGN KEY (base_code) REFERENCES currencies(code),
+    CONSTRAINT exchange_rates_quote_code_fkey FOREIGN KEY (quote_code) REFERENCES currencies(code),
+    CONSTRAINT exchange_rates_rate_check CHECK (rate > 0),
+    CONSTRAINT exchange_rates_pair_check CHECK (base_code <> quote_code)
+);
+
+INSERT INTO exchange_rates (base_code, quote_code, rate) VALUES
+    ('USD', 'EUR', 0.92),
+    ('USD', 'GBP', 0.79),
+    ('USD', 'INR', 83.25),
+    ('USD', 'JPY', 151.50)
+ON CONFLICT (base_code, quote_code) DO NOTHING;
+
+-- Existing prices, orders and payments were all in US dollars
+ALTER TABLE products ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'USD' CONSTRAINT products_currency_fkey REFERENCES currencies(code);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'USD' CONSTRAINT orders_currency_fkey REFERENCES currencies(code);
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'USD' CONSTRAINT payments_currency_fkey REFERENCES currencies(code);
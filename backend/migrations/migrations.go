@@ -0,0 +1,8 @@
+package migrations
+
+import "embed"
+
+// FS holds the versioned schema files, NNN_name.up.sql and NNN_name.down.sql.
+//
+//go:embed *.sql
+var FS embed.FS
@@ -2,13 +2,17 @@ package models
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
+
+	"github.com/avnpl/go-march/money"
 )
 
 type Product struct {
 	ProductID  string       `db:"prod_id" json:"prod_id"`
 	Name       string       `db:"prod_name" json:"prod_name"`
-	Price      float64      `db:"price" json:"price"`
+	Price      money.Amount `db:"price" json:"price"`
+	Currency   string       `db:"currency" json:"currency"`
 	Stock      int          `db:"stock" json:"stock"`
 	CreatedAt  time.Time    `db:"created_at" json:"created_at"`
 	UpdatedAt  time.Time    `db:"updated_at" json:"updated_at"`
@@ -16,22 +20,191 @@ type Product struct {
 }
 
 type Orders struct {
-	OrderID   string    `db:"order_id"`
-	Quantity  int       `db:"quantity"`
-	ProductID string    `db:"product_id"`
-	Amount    float64   `db:"amount"`
-	CreatedAt time.Time `db:"order_time"`
+	OrderID         string       `db:"order_id" json:"order_id"`
+	ProductID       string       `db:"product_id" json:"product_id"`
+	Quantity        int          `db:"quantity" json:"quantity"`
+	TotalPrice      money.Amount `db:"total_price" json:"total_price"`
+	Currency        string       `db:"currency" json:"currency"`
+	CreatedAt       time.Time    `db:"order_time" json:"order_time"`
+	Status          string       `db:"status" json:"status"`
+	ShippingAddress *string      `db:"shipping_address" json:"shipping_address"`
+	Notes           *string      `db:"notes" json:"notes"`
+	TTLExpires      sql.NullTime `db:"ttl_expires_at" json:"-"`
+}
+
+type Payment struct {
+	PaymentID    string         `db:"payment_id" json:"payment_id"`
+	OrderID      string         `db:"order_id" json:"order_id"`
+	Amount       money.Amount   `db:"amount" json:"amount"`
+	Currency     string         `db:"currency" json:"currency"`
+	Status       string         `db:"status" json:"status"`
+	CardToken    sql.NullString `db:"card_token" json:"-"`
+	CardBrand    string         `db:"card_brand" json:"card_brand"`
+	CardLastFour string         `db:"card_last_four" json:"card_last_four"`
+	CreatedAt    time.Time      `db:"created_at" json:"created_at"`
+	TTLExpires   sql.NullTime   `db:"ttl_expires_at" json:"-"`
+}
+
+// Card is a vault entry. The full card number is never stored, only the token
+// that payments reference and what is safe to show back to the client.
+type Card struct {
+	Token        string       `db:"token" json:"card_token"`
+	Brand        string       `db:"brand" json:"brand"`
+	CardLastFour string       `db:"card_last_four" json:"card_last_four"`
+	ExpMonth     int          `db:"exp_month" json:"exp_month"`
+	ExpYear      int          `db:"exp_year" json:"exp_year"`
+	CreatedAt    time.Time    `db:"created_at" json:"created_at"`
+	TTLExpires   sql.NullTime `db:"ttl_expires_at" json:"-"`
 }
 
 type CreateProductReq struct {
-	Name  string  `json:"name" validate:"required"`
-	Price float64 `json:"price" validate:"gt=0"`
-	Stock int     `json:"stock" validate:"min=0"`
+	Name     string       `json:"name" validate:"required"`
+	Price    money.Amount `json:"price" validate:"gt=0"`
+	Currency string       `json:"currency,omitempty" validate:"omitempty,len=3,uppercase"`
+	Stock    int          `json:"stock" validate:"min=0"`
+}
+
+type CreateOrderReq struct {
+	ProductID       string  `json:"product_id" validate:"required"`
+	Quantity        int     `json:"quantity" validate:"gt=0"`
+	ShippingAddress *string `json:"shipping_address,omitempty"`
+	Notes           *string `json:"notes,omitempty"`
+}
+
+// ProductSortColumns maps the public sort keys of the product list onto their
+// columns. A leading "-" on the key sorts descending.
+var ProductSortColumns = map[string]string{
+	"price":      "price",
+	"name":       "prod_name",
+	"created_at": "created_at",
 }
 
+type ProductListOpts struct {
+	Limit        int
+	Cursor       string
+	Sort         string
+	MinPrice     *money.Amount
+	MaxPrice     *money.Amount
+	InStock      *bool
+	NameContains string
+	// PriceCurrency limits the list to products priced in it. Prices in
+	// different currencies do not compare, so price filters and the price
+	// sort need it.
+	PriceCurrency string
+}
+
+// ProductCursor is the keyset position of the last row of a page: the value of
+// the sort column and the product ID as a tie breaker.
+type ProductCursor struct {
+	Sort      string `json:"s"`
+	Value     string `json:"v"`
+	ProductID string `json:"id"`
+}
+
+type ProductPage struct {
+	Products   []Product `json:"products"`
+	NextCursor *string   `json:"next_cursor"`
+	TotalCount int       `json:"total_count"`
+}
+
+type OrderListOpts struct {
+	Limit  int
+	Cursor string
+	Status string
+}
+
+// OrderCursor is the keyset position of the last order of a page, orders are
+// listed newest first with the order ID as a tie breaker.
+type OrderCursor struct {
+	OrderTime time.Time `json:"t"`
+	OrderID   string    `json:"id"`
+}
+
+type OrderPage struct {
+	Orders     []Orders `json:"orders"`
+	NextCursor *string  `json:"next_cursor"`
+}
+
+// UpdateProductReq changes only the fields that are set, so a patch can set
+// stock to 0 without touching the rest.
 type UpdateProductReq struct {
-	ProductID string  `json:"prod_id" validate:"required"`
-	Name      string  `json:"name,omitempty"`
-	Price     float64 `json:"price,omitempty" validate:"omitempty,gt=0"`
-	Stock     int     `json:"stock,omitempty" validate:"omitempty,min=0"`
+	ProductID  string        `json:"prod_id" validate:"required"`
+	Name       *string       `json:"name,omitempty" validate:"omitnil,min=1"`
+	Price      *money.Amount `json:"price,omitempty" validate:"omitnil,gt=0"`
+	Stock      *int          `json:"stock,omitempty" validate:"omitnil,min=0"`
+	TTLExpires sql.NullTime  `json:"-"`
+	// Test holds the values the stored product must have for the update to
+	// apply, from the test operations of a JSON Patch.
+	Test ProductTest `json:"-" validate:"-"`
+}
+
+// Empty reports whether the request changes nothing.
+func (r UpdateProductReq) Empty() bool {
+	return r.Name == nil && r.Price == nil && r.Stock == nil
+}
+
+type ProductTest struct {
+	Name  *string
+	Price *money.Amount
+	Stock *int
+}
+
+// Empty reports whether the test holds for any product.
+func (t ProductTest) Empty() bool {
+	return t.Name == nil && t.Price == nil && t.Stock == nil
+}
+
+type UpdateOrderReq struct {
+	ShippingAddress *string      `json:"shipping_address,omitempty"`
+	Notes           *string      `json:"notes,omitempty"`
+	TTLExpires      sql.NullTime `json:"-"`
+}
+
+type TokenizeCardReq struct {
+	CardNumber string `json:"card_number" validate:"required,numeric,min=12,max=19"`
+	ExpMonth   int    `json:"exp_month" validate:"min=1,max=12"`
+	ExpYear    int    `json:"exp_year" validate:"min=2000,max=2099"`
+}
+
+// CreatePaymentReq takes either a token from POST /cards or the card itself,
+// which is tokenized before the payment is processed.
+type CreatePaymentReq struct {
+	OrderID   string           `json:"order_id" validate:"required"`
+	CardToken string           `json:"card_token,omitempty" validate:"required_without=Card,excluded_with=Card"`
+	Card      *TokenizeCardReq `json:"card,omitempty" validate:"required_without=CardToken,omitempty"`
+}
+
+type HealthReport struct {
+	Status string              `json:"status"`
+	Checks []HealthCheckResult `json:"checks,omitempty"`
+}
+
+type HealthCheckResult struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type Currency struct {
+	Code       string `db:"code" json:"code"`
+	Name       string `db:"name" json:"name"`
+	MinorUnits int    `db:"minor_units" json:"minor_units"`
+}
+
+// ExchangeRate says one unit of Base is worth Rate units of Quote.
+type ExchangeRate struct {
+	Base      string    `db:"base_code" json:"base"`
+	Quote     string    `db:"quote_code" json:"quote"`
+	Rate      string    `db:"rate" json:"rate"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type SaveCurrencyReq struct {
+	Name       string `json:"name" validate:"required,max=64"`
+	MinorUnits *int   `json:"minor_units" validate:"required,min=0,max=2"`
+}
+
+type SetExchangeRateReq struct {
+	Rate json.Number `json:"rate" validate:"required"`
 }
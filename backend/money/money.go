@@ -0,0 +1,204 @@
+package money
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of decimal places an Amount carries, matching the
+// DECIMAL(10, 2) price columns.
+const Scale = 2
+
+const centsPerUnit = 100
+
+// Integer digits beyond this would overflow int64 cents.
+const maxIntegerDigits = 16
+
+var (
+	ErrInvalidAmount = errors.New("invalid amount")
+	ErrTooPrecise    = errors.New("amount has more than 2 decimal places")
+)
+
+// Amount is an exact decimal with two places, stored as a count of cents.
+// Arithmetic on it never goes through float64, so totals such as 3 * 49.99 are
+// always 149.97. It encodes to JSON as a plain number and accepts numbers or
+// strings when decoding.
+type Amount int64
+
+func FromCents(cents int64) Amount {
+	return Amount(cents)
+}
+
+// Parse reads a decimal such as "149.97", "-3" or "0.5". Digits past the
+// second decimal place must be zero.
+func Parse(in string) (Amount, error) {
+	s, neg := in, false
+	switch {
+	case strings.HasPrefix(s, "-"):
+		neg, s = true, s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+
+	whole, frac, hasDot := strings.Cut(s, ".")
+	if (whole == "" && frac == "") || (hasDot && frac == "") {
+		return 0, fmt.Errorf("%q: %w", in, ErrInvalidAmount)
+	}
+	if !digitsOnly(whole) || !digitsOnly(frac) || len(whole) > maxIntegerDigits {
+		return 0, fmt.Errorf("%q: %w", in, ErrInvalidAmount)
+	}
+	if len(frac) > Scale {
+		if strings.Trim(frac[Scale:], "0") != "" {
+			return 0, fmt.Errorf("%q: %w", in, ErrTooPrecise)
+		}
+		frac = frac[:Scale]
+	}
+	frac += strings.Repeat("0", Scale-len(frac))
+
+	cents, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q: %w", in, ErrInvalidAmount)
+	}
+	if neg {
+		cents = -cents
+	}
+	return Amount(cents), nil
+}
+
+func digitsOnly(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (a Amount) Cents() int64 {
+	return int64(a)
+}
+
+// FitsPlaces reports whether the amount needs no more than places decimals,
+// the minor units of its currency: 10.50 fits EUR (2) but not JPY (0).
+func (a Amount) FitsPlaces(places int) bool {
+	unit := int64(1)
+	for i := places; i < Scale; i++ {
+		unit *= 10
+	}
+	return int64(a)%unit == 0
+}
+
+// Mul returns the amount times a whole quantity, e.g. a line total.
+func (a Amount) Mul(quantity int) Amount {
+	return a * Amount(quantity)
+}
+
+// String formats the amount with exactly two decimals, e.g. "149.97".
+func (a Amount) String() string {
+	cents := int64(a)
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/centsPerUnit, cents%centsPerUnit)
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	s := string(data)
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// Scan reads a NUMERIC column, which the pgx driver hands over as text.
+func (a *Amount) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	case int64:
+		*a = Amount(v * centsPerUnit)
+		return nil
+	default:
+		return fmt.Errorf("money: cannot scan %T into Amount", src)
+	}
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// Value passes the amount as decimal text so the database parses it exactly.
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+// RateScale is the number of decimal places an exchange rate may have,
+// matching the DECIMAL(18, 8) rate column.
+const RateScale = 8
+
+var ErrInvalidRate = errors.New("exchange rate must be a positive decimal with at most 8 decimal places")
+
+// ParseRate reads an exchange rate such as "0.92" or "151.5".
+func ParseRate(s string) (*big.Rat, error) {
+	_, frac, _ := strings.Cut(strings.TrimRight(s, "0"), ".")
+	if len(frac) > RateScale || strings.ContainsAny(s, "eE/") {
+		return nil, fmt.Errorf("%q: %w", s, ErrInvalidRate)
+	}
+	rate, ok := new(big.Rat).SetString(s)
+	if !ok || rate.Sign() <= 0 {
+		return nil, fmt.Errorf("%q: %w", s, ErrInvalidRate)
+	}
+	return rate, nil
+}
+
+// Convert multiplies the amount by rate and rounds the exact result half away
+// from zero to places decimals, the minor units of the target currency (0 for
+// JPY, 2 for EUR). The product is computed exactly, only the final value is
+// rounded.
+func (a Amount) Convert(rate *big.Rat, places int) (Amount, error) {
+	if places < 0 || places > Scale {
+		return 0, fmt.Errorf("money: %d decimal places is not supported", places)
+	}
+
+	// Work in units of the last kept place, e.g. whole yen are 100 cents.
+	unit := big.NewInt(1)
+	for i := places; i < Scale; i++ {
+		unit.Mul(unit, big.NewInt(10))
+	}
+	exact := new(big.Rat).Mul(new(big.Rat).SetInt64(int64(a)), rate)
+	exact.Quo(exact, new(big.Rat).SetInt(unit))
+
+	q, r := new(big.Int).QuoRem(exact.Num(), exact.Denom(), new(big.Int))
+	if r.Sign() != 0 && new(big.Int).Mul(new(big.Int).Abs(r), big.NewInt(2)).Cmp(exact.Denom()) >= 0 {
+		q.Add(q, big.NewInt(int64(exact.Sign())))
+	}
+
+	q.Mul(q, unit)
+	if !q.IsInt64() {
+		return 0, fmt.Errorf("money: %s converted at %s: %w", a, rate.FloatString(RateScale), ErrInvalidAmount)
+	}
+	return Amount(q.Int64()), nil
+}
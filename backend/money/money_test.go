@@ -0,0 +1,92 @@
+package money
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Amount
+		err  error
+	}{
+		{in: "149.97", want: 14997},
+		{in: "0.5", want: 50},
+		{in: "3", want: 300},
+		{in: "+3", want: 300},
+		{in: "-3", want: -300},
+		{in: "-0.01", want: -1},
+		{in: ".5", want: 50},
+		{in: "1.500", want: 150},
+		{in: "1.005", err: ErrTooPrecise},
+		{in: "-1.001", err: ErrTooPrecise},
+		{in: "", err: ErrInvalidAmount},
+		{in: ".", err: ErrInvalidAmount},
+		{in: "1.", err: ErrInvalidAmount},
+		{in: "1e3", err: ErrInvalidAmount},
+		{in: "--1", err: ErrInvalidAmount},
+		{in: "12345678901234567", err: ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Parse(%q) error = %v, want %v", tt.in, err, tt.err)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("Parse(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	rate := func(s string) *big.Rat {
+		r, err := ParseRate(s)
+		if err != nil {
+			t.Fatalf("ParseRate(%q): %v", s, err)
+		}
+		return r
+	}
+
+	tests := []struct {
+		name   string
+		amount Amount
+		rate   string
+		places int
+		want   Amount
+	}{
+		{name: "exact", amount: 1000, rate: "0.92", places: 2, want: 920},
+		{name: "rounds half up", amount: 1, rate: "0.5", places: 2, want: 1},
+		{name: "rounds down below half", amount: 1, rate: "0.49", places: 2, want: 0},
+		{name: "negative rounds half away from zero", amount: -1, rate: "0.5", places: 2, want: -1},
+		{name: "negative rounds toward zero below half", amount: -1, rate: "0.49", places: 2, want: 0},
+		{name: "whole units", amount: 1499, rate: "151.50", places: 0, want: 227100},
+		{name: "whole units half", amount: 1, rate: "50", places: 0, want: 100},
+		{name: "negative whole units", amount: -1499, rate: "151.50", places: 0, want: -227100},
+		{name: "rounds once on the exact product", amount: 333, rate: "1.005", places: 2, want: 335},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.amount.Convert(rate(tt.rate), tt.places)
+			if err != nil {
+				t.Fatalf("Convert: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("%s * %s to %d places = %s, want %s", tt.amount, tt.rate, tt.places, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	one := big.NewRat(1, 1)
+	if _, err := Amount(100).Convert(one, 3); err == nil {
+		t.Error("Convert to 3 places: want an error")
+	}
+	if _, err := Amount(1<<62).Convert(big.NewRat(4, 1), 2); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("Convert overflowing int64: error = %v, want %v", err, ErrInvalidAmount)
+	}
+}
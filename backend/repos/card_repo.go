@@ -0,0 +1,46 @@
+package repos
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/avnpl/go-march/models"
+	"github.com/jmoiron/sqlx"
+)
+
+type CardRepo interface {
+	Create(ctx context.Context, c *models.Card) (models.Card, error)
+	FetchByToken(ctx context.Context, token string) (models.Card, error)
+}
+
+type pgCardRepo struct {
+	db *sqlx.DB
+}
+
+func NewPGCardRepo(db *sqlx.DB) CardRepo {
+	return pgCardRepo{db: db}
+}
+
+func (r pgCardRepo) Create(ctx context.Context, c *models.Card) (models.Card, error) {
+	const query = "insert into card_tokens (token, brand, card_last_four, exp_month, exp_year, ttl_expires_at) values ($1, $2, $3, $4, $5, $6) returning *"
+
+	var res models.Card
+	err := runInTx(ctx, r.db, func(tx *sqlx.Tx) error {
+		return tx.GetContext(ctx, &res, query, c.Token, c.Brand, c.CardLastFour, c.ExpMonth, c.ExpYear, c.TTLExpires)
+	})
+	if err != nil {
+		return models.Card{}, fmt.Errorf("card_repo.Create: %w", err)
+	}
+	return res, nil
+}
+
+func (r pgCardRepo) FetchByToken(ctx context.Context, token string) (models.Card, error) {
+	const query = "select * from card_tokens where token = $1"
+
+	var result models.Card
+	err := r.db.GetContext(ctx, &result, query, token)
+	if err != nil {
+		return result, fmt.Errorf("card_repo.FetchByToken: %w", dbError(err))
+	}
+	return result, nil
+}
@@ -0,0 +1,88 @@
+package repos
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/avnpl/go-march/models"
+	"github.com/jmoiron/sqlx"
+)
+
+type CurrencyRepo interface {
+	FetchAll(ctx context.Context) ([]models.Currency, error)
+	Upsert(ctx context.Context, c *models.Currency) (models.Currency, error)
+	FetchRates(ctx context.Context) ([]models.ExchangeRate, error)
+	UpsertRate(ctx context.Context, rate *models.ExchangeRate) (models.ExchangeRate, error)
+	DeleteRate(ctx context.Context, base string, quote string) (models.ExchangeRate, error)
+}
+
+type pgCurrencyRepo struct {
+	db *sqlx.DB
+}
+
+func NewPGCurrencyRepo(db *sqlx.DB) CurrencyRepo {
+	return pgCurrencyRepo{db: db}
+}
+
+func (r pgCurrencyRepo) FetchAll(ctx context.Context) ([]models.Currency, error) {
+	const query = "select * from currencies order by code"
+
+	result := []models.Currency{}
+	if err := r.db.SelectContext(ctx, &result, query); err != nil {
+		return result, fmt.Errorf("currency_repo.FetchAll: %w", dbError(err))
+	}
+	return result, nil
+}
+
+func (r pgCurrencyRepo) Upsert(ctx context.Context, c *models.Currency) (models.Currency, error) {
+	const query = `insert into currencies (code, name, minor_units) values ($1, $2, $3)
+		on conflict (code) do update set name = excluded.name, minor_units = excluded.minor_units
+		returning *`
+
+	var res models.Currency
+	err := runInTx(ctx, r.db, func(tx *sqlx.Tx) error {
+		return tx.GetContext(ctx, &res, query, c.Code, c.Name, c.MinorUnits)
+	})
+	if err != nil {
+		return models.Currency{}, fmt.Errorf("currency_repo.Upsert: %w", err)
+	}
+	return res, nil
+}
+
+func (r pgCurrencyRepo) FetchRates(ctx context.Context) ([]models.ExchangeRate, error) {
+	const query = "select * from exchange_rates order by base_code, quote_code"
+
+	result := []models.ExchangeRate{}
+	if err := r.db.SelectContext(ctx, &result, query); err != nil {
+		return result, fmt.Errorf("currency_repo.FetchRates: %w", dbError(err))
+	}
+	return result, nil
+}
+
+func (r pgCurrencyRepo) UpsertRate(ctx context.Context, rate *models.ExchangeRate) (models.ExchangeRate, error) {
+	const query = `insert into exchange_rates (base_code, quote_code, rate) values ($1, $2, $3)
+		on conflict (base_code, quote_code) do update set rate = excluded.rate, updated_at = now()
+		returning *`
+
+	var res models.ExchangeRate
+	err := runInTx(ctx, r.db, func(tx *sqlx.Tx) error {
+		return tx.GetContext(ctx, &res, query, rate.Base, rate.Quote, rate.Rate)
+	})
+	if err != nil {
+		return models.ExchangeRate{}, fmt.Errorf("currency_repo.UpsertRate: %w", err)
+	}
+	return res, nil
+}
+
+func (r pgCurrencyRepo) DeleteRate(ctx context.Context, base string, quote string) (models.ExchangeRate, error) {
+	const query = "delete from exchange_rates where base_code = $1 and quote_code = $2 returning *"
+
+	var res models.ExchangeRate
+	err := runInTx(ctx, r.db, func(tx *sqlx.Tx) error {
+		return tx.GetContext(ctx, &res, query, base, quote)
+	})
+	if err != nil {
+		return models.ExchangeRate{}, fmt.Errorf("currency_repo.DeleteRate: %w", err)
+	}
+	return res, nil
+}
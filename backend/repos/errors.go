@@ -0,0 +1,77 @@
+package repos
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/avnpl/go-march/utils"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// SQLSTATE codes shared by PostgreSQL and CockroachDB.
+const (
+	pgNotNullViolation     = "23502"
+	pgForeignKeyViolation  = "23503"
+	pgUniqueViolation      = "23505"
+	pgCheckViolation       = "23514"
+	pgInvalidTextRepr      = "22P02"
+	pgNumericOutOfRange    = "22003"
+	pgStringTooLong        = "22001"
+	pgSerializationFailure = "40001"
+)
+
+// Detail reads like `Key (product_id)=(PR-123) is not present in table "products".`
+var keyDetailPattern = regexp.MustCompile(`Key \(([^)]+)\)=`)
+
+// dbError translates driver errors into the sentinels in utils so that services
+// and handlers never look at SQLSTATE codes. Other errors are returned as is.
+func dbError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var translated *utils.DBError
+	if errors.As(err, &translated) {
+		return err
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return &utils.DBError{Kind: utils.ErrRecordNotFound, Err: err}
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	res := &utils.DBError{Field: pgErrorField(pgErr), Constraint: pgErr.ConstraintName, Err: err}
+	switch pgErr.Code {
+	case pgUniqueViolation:
+		res.Kind = utils.ErrConflict
+	case pgForeignKeyViolation:
+		// Inserting a dangling reference is the caller's mistake, deleting a row
+		// that is still referenced conflicts with the rows pointing at it.
+		if strings.Contains(pgErr.Detail, "still referenced") {
+			res.Kind = utils.ErrConflict
+		} else {
+			res.Kind = utils.ErrInvalidRequest
+		}
+	case pgCheckViolation, pgNotNullViolation, pgInvalidTextRepr, pgNumericOutOfRange, pgStringTooLong:
+		res.Kind = utils.ErrInvalidRequest
+	case pgSerializationFailure:
+		res.Kind = utils.ErrSerializationFailure
+	default:
+		return err
+	}
+	return res
+}
+
+func pgErrorField(pgErr *pgconn.PgError) string {
+	if pgErr.ColumnName != "" {
+		return pgErr.ColumnName
+	}
+	if m := keyDetailPattern.FindStringSubmatch(pgErr.Detail); m != nil {
+		return m[1]
+	}
+	return ""
+}
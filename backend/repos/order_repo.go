@@ -1 +1,171 @@
 package repos
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/avnpl/go-march/models"
+	"github.com/avnpl/go-march/money"
+	"github.com/avnpl/go-march/utils"
+	"github.com/jmoiron/sqlx"
+)
+
+type OrderRepo interface {
+	Create(ctx context.Context, o *models.Orders) (models.Orders, error)
+	FetchByID(ctx context.Context, id string) (models.Orders, error)
+	FetchAll(ctx context.Context) ([]models.Orders, error)
+	FetchPage(ctx context.Context, opts *models.OrderListOpts, after *models.OrderCursor) ([]models.Orders, error)
+	UpdateByID(ctx context.Context, id string, o *models.UpdateOrderReq) (models.Orders, error)
+}
+
+type pgOrderRepo struct {
+	db *sqlx.DB
+}
+
+func NewPGOrderRepo(db *sqlx.DB) OrderRepo {
+	return pgOrderRepo{db: db}
+}
+
+// Create decrements the product stock and inserts the order in one transaction.
+// The conditional update only matches when enough stock is left, so two
+// concurrent orders can never take the stock below zero.
+func (r pgOrderRepo) Create(ctx context.Context, o *models.Orders) (models.Orders, error) {
+	const decrementStock = `update products set stock = stock - $1, updated_at = now(),
+		ttl_expires_at = case when ttl_expires_at is null then null else coalesce($3, ttl_expires_at) end
+		where prod_id = $2 and stock >= $1 returning price * $1 as total, currency`
+	const insertOrder = "insert into orders (order_id, product_id, quantity, total_price, currency, status, shipping_address, notes, ttl_expires_at) values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning *"
+
+	var res models.Orders
+	err := runInTx(ctx, r.db, func(tx *sqlx.Tx) error {
+		// The total is computed by the database on the DECIMAL price, in the
+		// currency of the product.
+		var priced struct {
+			Total    money.Amount `db:"total"`
+			Currency string       `db:"currency"`
+		}
+		if err := tx.GetContext(ctx, &priced, decrementStock, o.Quantity, o.ProductID, o.TTLExpires); err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+			// No row matched: either there is no such product or too little
+			// of it is left.
+			var exists bool
+			if err := tx.GetContext(ctx, &exists, "select exists(select 1 from products where prod_id = $1)", o.ProductID); err != nil {
+				return err
+			}
+			if !exists {
+				return utils.ErrProductNotFound
+			}
+			return utils.ErrInsufficientStock
+		}
+		return tx.GetContext(ctx, &res, insertOrder, o.OrderID, o.ProductID, o.Quantity, priced.Total, priced.Currency, o.Status, o.ShippingAddress, o.Notes, o.TTLExpires)
+	})
+	if err != nil {
+		return models.Orders{}, fmt.Errorf("order_repo.Create: %w", err)
+	}
+	return res, nil
+}
+
+func (r pgOrderRepo) FetchByID(ctx context.Context, id string) (models.Orders, error) {
+	const query = "select * from orders where order_id = $1"
+
+	var result models.Orders
+	err := r.db.GetContext(ctx, &result, query, id)
+	if err != nil {
+		return result, fmt.Errorf("order_repo.FetchByID: %w", dbError(err))
+	}
+	return result, nil
+}
+
+func (r pgOrderRepo) FetchAll(ctx context.Context) ([]models.Orders, error) {
+	const query = "select * from orders order by order_time desc"
+
+	var result []models.Orders
+	err := r.db.SelectContext(ctx, &result, query)
+	if err != nil {
+		return result, fmt.Errorf("order_repo.FetchAll: %w", dbError(err))
+	}
+	return result, nil
+}
+
+func (r pgOrderRepo) UpdateByID(ctx context.Context, id string, o *models.UpdateOrderReq) (models.Orders, error) {
+	query := "update orders set "
+	args := make(map[string]interface{})
+	var fieldsToUpdate []string
+
+	if o.ShippingAddress != nil {
+		fieldsToUpdate = append(fieldsToUpdate, "shipping_address = :shipping_address")
+		args["shipping_address"] = *o.ShippingAddress
+	}
+
+	if o.Notes != nil {
+		fieldsToUpdate = append(fieldsToUpdate, "notes = :notes")
+		args["notes"] = *o.Notes
+	}
+
+	if len(fieldsToUpdate) == 0 {
+		return models.Orders{}, fmt.Errorf("order_repo.Update: %w", utils.ErrInvalidRequest)
+	}
+
+	// Rows without an expiry are seed data and stay permanent.
+	if o.TTLExpires.Valid {
+		fieldsToUpdate = append(fieldsToUpdate, "ttl_expires_at = case when ttl_expires_at is null then null else :ttl_expires_at end")
+		args["ttl_expires_at"] = o.TTLExpires
+	}
+
+	query += strings.Join(fieldsToUpdate, ", ")
+	query += " where order_id = :order_id returning *"
+	args["order_id"] = id
+
+	query, bound, err := r.db.BindNamed(query, args)
+	if err != nil {
+		return models.Orders{}, fmt.Errorf("order_repo.Update: %w", err)
+	}
+
+	var res models.Orders
+	err = runInTx(ctx, r.db, func(tx *sqlx.Tx) error {
+		return tx.GetContext(ctx, &res, query, bound...)
+	})
+	if err != nil {
+		return models.Orders{}, fmt.Errorf("order_repo.Update: %w", err)
+	}
+	return res, nil
+}
+
+// FetchPage returns up to opts.Limit orders, newest first, starting after the
+// keyset position in after (if any).
+func (r pgOrderRepo) FetchPage(ctx context.Context, opts *models.OrderListOpts, after *models.OrderCursor) ([]models.Orders, error) {
+	var conditions []string
+	args := map[string]interface{}{"limit": opts.Limit}
+
+	if opts.Status != "" {
+		conditions = append(conditions, "status = :status")
+		args["status"] = opts.Status
+	}
+	if after != nil {
+		conditions = append(conditions, "(order_time, order_id) < (:after_time, :after_id)")
+		args["after_time"] = after.OrderTime
+		args["after_id"] = after.OrderID
+	}
+
+	query := "select * from orders"
+	if len(conditions) > 0 {
+		query += " where " + strings.Join(conditions, " and ")
+	}
+	query += " order by order_time desc, order_id desc limit :limit"
+
+	query, bound, err := r.db.BindNamed(query, args)
+	if err != nil {
+		return nil, fmt.Errorf("order_repo.FetchPage: %w", dbError(err))
+	}
+
+	result := []models.Orders{}
+	err = r.db.SelectContext(ctx, &result, query, bound...)
+	if err != nil {
+		return result, fmt.Errorf("order_repo.FetchPage: %w", dbError(err))
+	}
+	return result, nil
+}
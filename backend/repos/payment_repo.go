@@ -0,0 +1,62 @@
+package repos
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/avnpl/go-march/models"
+	"github.com/avnpl/go-march/utils"
+	"github.com/jmoiron/sqlx"
+)
+
+type PaymentRepo interface {
+	Create(ctx context.Context, p *models.Payment, orderStatus string) (models.Payment, models.Orders, error)
+	FetchByID(ctx context.Context, id string) (models.Payment, error)
+}
+
+type pgPaymentRepo struct {
+	db *sqlx.DB
+}
+
+func NewPGPaymentRepo(db *sqlx.DB) PaymentRepo {
+	return pgPaymentRepo{db: db}
+}
+
+// Create inserts the payment and moves its order out of "pending" in one
+// transaction, returning both as stored. An order that is no longer pending is
+// reported as not payable.
+func (r pgPaymentRepo) Create(ctx context.Context, p *models.Payment, orderStatus string) (models.Payment, models.Orders, error) {
+	const updateOrder = `update orders set status = $1,
+		ttl_expires_at = case when ttl_expires_at is null then null else coalesce($3, ttl_expires_at) end
+		where order_id = $2 and status = 'pending' returning *`
+	const insertPayment = "insert into payments (payment_id, order_id, amount, currency, status, card_token, card_brand, card_last_four, ttl_expires_at) values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning *"
+
+	var res models.Payment
+	var order models.Orders
+	err := runInTx(ctx, r.db, func(tx *sqlx.Tx) error {
+		if err := tx.GetContext(ctx, &order, updateOrder, orderStatus, p.OrderID, p.TTLExpires); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return utils.ErrOrderNotPayable
+			}
+			return err
+		}
+		return tx.GetContext(ctx, &res, insertPayment, p.PaymentID, p.OrderID, p.Amount, p.Currency, p.Status, p.CardToken, p.CardBrand, p.CardLastFour, p.TTLExpires)
+	})
+	if err != nil {
+		return models.Payment{}, models.Orders{}, fmt.Errorf("payment_repo.Create: %w", err)
+	}
+	return res, order, nil
+}
+
+func (r pgPaymentRepo) FetchByID(ctx context.Context, id string) (models.Payment, error) {
+	const query = "select * from payments where payment_id = $1"
+
+	var result models.Payment
+	err := r.db.GetContext(ctx, &result, query, id)
+	if err != nil {
+		return result, fmt.Errorf("payment_repo.FetchByID: %w", dbError(err))
+	}
+	return result, nil
+}
@@ -3,17 +3,27 @@ package repos
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/avnpl/go-march/models"
+	"github.com/avnpl/go-march/money"
+	"github.com/avnpl/go-march/tracing"
+	"github.com/avnpl/go-march/utils"
 	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type ProductRepo interface {
 	Create(ctx context.Context, p *models.Product) (models.Product, error)
 	FetchByID(ctx context.Context, id string) (models.Product, error)
-	FetchAll(ctx context.Context) ([]models.Product, error)
+	FetchByIDs(ctx context.Context, ids []string) ([]models.Product, error)
+	FetchAll(ctx context.Context, opts *models.ProductListOpts, after *models.ProductCursor) ([]models.Product, error)
+	Count(ctx context.Context, opts *models.ProductListOpts) (int, error)
 	UpdateByID(ctx context.Context, p *models.UpdateProductReq) (models.Product, error)
 	DeleteByID(ctx context.Context, id string) (models.Product, error)
 }
@@ -26,89 +36,303 @@ func NewPGProductRepo(db *sqlx.DB) ProductRepo {
 	return pgProductRepo{db: db}
 }
 
-func (r pgProductRepo) Create(ctx context.Context, p *models.Product) (models.Product, error) {
-	const query = "insert into products (prod_id, prod_name, price, stock) values ($1, $2, $3, $4) returning *"
+func (r pgProductRepo) Create(ctx context.Context, p *models.Product) (_ models.Product, err error) {
+	const query = "insert into products (prod_id, prod_name, price, currency, stock, ttl_expires_at) values ($1, $2, $3, $4, $5, $6) returning *"
+	ctx, span := startSpan(ctx, "product_repo.Create")
+	span.SetAttributes(semconv.DBQueryText(query))
+	defer func() { tracing.End(span, err) }()
 
 	var res models.Product
-	if err := r.db.GetContext(ctx, &res, query, p.ProductID, p.Name, p.Price, p.Stock); err != nil {
+	err = runInTx(ctx, r.db, func(tx *sqlx.Tx) error {
+		var places int
+		if err := tx.GetContext(ctx, &places, "select minor_units from currencies where code = $1", p.Currency); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return utils.ErrUnknownCurrency
+			}
+			return err
+		}
+		if !p.Price.FitsPlaces(places) {
+			return utils.ErrPriceTooPrecise
+		}
+		return tx.GetContext(ctx, &res, query, p.ProductID, p.Name, p.Price, p.Currency, p.Stock, p.TTLExpires)
+	})
+	if err != nil {
 		return models.Product{}, fmt.Errorf("product_repo.Create: %w", err)
 	}
 	return res, nil
 }
 
-func (r pgProductRepo) FetchByID(ctx context.Context, id string) (models.Product, error) {
+func (r pgProductRepo) FetchByID(ctx context.Context, id string) (_ models.Product, err error) {
 	const query = "select * from products where prod_id = $1"
+	ctx, span := startSpan(ctx, "product_repo.FetchByID")
+	span.SetAttributes(semconv.DBQueryText(query))
+	defer func() { tracing.End(span, err) }()
 
 	var result models.Product
-	err := r.db.GetContext(ctx, &result, query, id)
+	err = r.db.GetContext(ctx, &result, query, id)
 	if err != nil {
-		return result, fmt.Errorf("product_repo.FetchByID: %w", err)
+		return result, fmt.Errorf("product_repo.FetchByID: %w", dbError(err))
 	}
 	return result, nil
 }
 
-func (r pgProductRepo) FetchAll(ctx context.Context) ([]models.Product, error) {
-	const query = "select * from products"
+// FetchByIDs returns the products with the given IDs in one query, in no
+// particular order. IDs without a product are left out.
+func (r pgProductRepo) FetchByIDs(ctx context.Context, ids []string) (_ []models.Product, err error) {
+	const query = "select * from products where prod_id = any($1)"
+	ctx, span := startSpan(ctx, "product_repo.FetchByIDs")
+	span.SetAttributes(semconv.DBQueryText(query), attribute.Int("db.query.ids", len(ids)))
+	defer func() { tracing.End(span, err) }()
 
-	var result []models.Product
-	err := r.db.SelectContext(ctx, &result, query)
+	result := []models.Product{}
+	err = r.db.SelectContext(ctx, &result, query, ids)
 	if err != nil {
-		return result, fmt.Errorf("product_repo.FetchAllProducts: %w", err)
+		return result, fmt.Errorf("product_repo.FetchByIDs: %w", dbError(err))
 	}
 	return result, nil
 }
 
-func (r pgProductRepo) UpdateByID(ctx context.Context, p *models.UpdateProductReq) (models.Product, error) {
+// FetchAll returns up to opts.Limit products in opts.Sort order, starting
+// after the keyset position in after (if any).
+func (r pgProductRepo) FetchAll(ctx context.Context, opts *models.ProductListOpts, after *models.ProductCursor) (_ []models.Product, err error) {
+	ctx, span := startSpan(ctx, "product_repo.FetchAll")
+	defer func() { tracing.End(span, err) }()
+
+	column, desc := productSortColumn(opts.Sort)
+	conditions, args := productFilters(opts)
+
+	if after != nil {
+		value, err := productCursorValue(opts.Sort, after.Value)
+		if err != nil {
+			return nil, fmt.Errorf("product_repo.FetchAll: %w", dbError(err))
+		}
+		op := ">"
+		if desc {
+			op = "<"
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s, prod_id) %s (:after_value, :after_id)", column, op))
+		args["after_value"] = value
+		args["after_id"] = after.ProductID
+	}
+
+	direction := "asc"
+	if desc {
+		direction = "desc"
+	}
+
+	query := "select * from products"
+	if len(conditions) > 0 {
+		query += " where " + strings.Join(conditions, " and ")
+	}
+	query += fmt.Sprintf(" order by %s %s, prod_id %s limit :limit", column, direction, direction)
+	args["limit"] = opts.Limit
+
+	query, bound, err := r.db.BindNamed(query, args)
+	if err != nil {
+		return nil, fmt.Errorf("product_repo.FetchAll: %w", dbError(err))
+	}
+	span.SetAttributes(semconv.DBQueryText(query))
+
+	result := []models.Product{}
+	err = r.db.SelectContext(ctx, &result, query, bound...)
+	if err != nil {
+		return result, fmt.Errorf("product_repo.FetchAll: %w", dbError(err))
+	}
+	return result, nil
+}
+
+func (r pgProductRepo) Count(ctx context.Context, opts *models.ProductListOpts) (_ int, err error) {
+	ctx, span := startSpan(ctx, "product_repo.Count")
+	defer func() { tracing.End(span, err) }()
+
+	conditions, args := productFilters(opts)
+
+	query := "select count(*) from products"
+	if len(conditions) > 0 {
+		query += " where " + strings.Join(conditions, " and ")
+	}
+
+	query, bound, err := r.db.BindNamed(query, args)
+	if err != nil {
+		return 0, fmt.Errorf("product_repo.Count: %w", dbError(err))
+	}
+	span.SetAttributes(semconv.DBQueryText(query))
+
+	var count int
+	if err := r.db.GetContext(ctx, &count, query, bound...); err != nil {
+		return 0, fmt.Errorf("product_repo.Count: %w", dbError(err))
+	}
+	return count, nil
+}
+
+func productSortColumn(sort string) (string, bool) {
+	key, desc := strings.CutPrefix(sort, "-")
+	column, ok := models.ProductSortColumns[key]
+	if !ok {
+		return "created_at", false
+	}
+	return column, desc
+}
+
+func productFilters(opts *models.ProductListOpts) ([]string, map[string]interface{}) {
+	var conditions []string
+	args := make(map[string]interface{})
+
+	if opts.PriceCurrency != "" {
+		conditions = append(conditions, "currency = :price_currency")
+		args["price_currency"] = opts.PriceCurrency
+	}
+	if opts.MinPrice != nil {
+		conditions = append(conditions, "price >= :min_price")
+		args["min_price"] = *opts.MinPrice
+	}
+	if opts.MaxPrice != nil {
+		conditions = append(conditions, "price <= :max_price")
+		args["max_price"] = *opts.MaxPrice
+	}
+	if opts.InStock != nil {
+		if *opts.InStock {
+			conditions = append(conditions, "stock > 0")
+		} else {
+			conditions = append(conditions, "stock = 0")
+		}
+	}
+	if opts.NameContains != "" {
+		conditions = append(conditions, "prod_name ilike :name_contains")
+		args["name_contains"] = "%" + escapeLike(opts.NameContains) + "%"
+	}
+	return conditions, args
+}
+
+// productCursorValue converts the cursor value back into the Go type of the
+// sort column so the driver binds it with the right type.
+func productCursorValue(sort string, value string) (interface{}, error) {
+	column, _ := productSortColumn(sort)
+	switch column {
+	case "price":
+		price, err := money.Parse(value)
+		if err != nil {
+			return nil, utils.ErrInvalidCursor
+		}
+		return price, nil
+	case "created_at":
+		ts, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, utils.ErrInvalidCursor
+		}
+		return ts, nil
+	default:
+		return value, nil
+	}
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func (r pgProductRepo) UpdateByID(ctx context.Context, p *models.UpdateProductReq) (_ models.Product, err error) {
+	ctx, span := startSpan(ctx, "product_repo.UpdateByID")
+	defer func() { tracing.End(span, err) }()
+
 	query := "update products set "
 	args := make(map[string]interface{})
 	var fieldsToUpdate []string
-	var res models.Product
 
-	if p.Name != "" {
+	if p.Name != nil {
 		fieldsToUpdate = append(fieldsToUpdate, "prod_name = :prod_name")
-		args["prod_name"] = p.Name
+		args["prod_name"] = *p.Name
 	}
 
-	if p.Stock != 0 {
+	if p.Stock != nil {
 		fieldsToUpdate = append(fieldsToUpdate, "stock = :stock")
-		args["stock"] = p.Stock
+		args["stock"] = *p.Stock
 	}
 
-	if p.Price != 0.0 {
+	if p.Price != nil {
 		fieldsToUpdate = append(fieldsToUpdate, "price = :price")
-		args["price"] = p.Price
+		args["price"] = *p.Price
+	}
+
+	// Rows without an expiry are seed data and stay permanent.
+	if p.TTLExpires.Valid {
+		fieldsToUpdate = append(fieldsToUpdate, "ttl_expires_at = case when ttl_expires_at is null then null else :ttl_expires_at end")
+		args["ttl_expires_at"] = p.TTLExpires
 	}
 
 	fieldsToUpdate = append(fieldsToUpdate, "updated_at = NOW()")
 	query += strings.Join(fieldsToUpdate, ", ")
-	query += " WHERE prod_id = :prod_id RETURNING *"
+	query += " WHERE prod_id = :prod_id"
 	args["prod_id"] = p.ProductID
 
-	result, err := r.db.NamedQueryContext(ctx, query, args)
+	if p.Test.Name != nil {
+		query += " AND prod_name = :test_prod_name"
+		args["test_prod_name"] = *p.Test.Name
+	}
+	if p.Test.Stock != nil {
+		query += " AND stock = :test_stock"
+		args["test_stock"] = *p.Test.Stock
+	}
+	if p.Test.Price != nil {
+		query += " AND price = :test_price"
+		args["test_price"] = *p.Test.Price
+	}
+	query += " RETURNING *"
+
+	query, bound, err := r.db.BindNamed(query, args)
 	if err != nil {
 		return models.Product{}, fmt.Errorf("product_repo.Update: %w", err)
 	}
-	defer result.Close()
+	span.SetAttributes(semconv.DBQueryText(query))
+	span.AddEvent("query built", trace.WithAttributes(attribute.Int("db.update.columns", len(fieldsToUpdate))))
 
-	if result.Next() {
-		err := result.StructScan(&res)
-		if err != nil {
-			return models.Product{}, fmt.Errorf("product_repo.Update: %w", err)
+	var res models.Product
+	err = runInTx(ctx, r.db, func(tx *sqlx.Tx) error {
+		if p.Price != nil {
+			// The currency of a product never changes, so its minor units can
+			// be read ahead of the update. A missing product is left to it.
+			var places int
+			err := tx.GetContext(ctx, &places, `select c.minor_units from products p
+				join currencies c on c.code = p.currency where p.prod_id = $1`, p.ProductID)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+			if err == nil && !p.Price.FitsPlaces(places) {
+				return utils.ErrPriceTooPrecise
+			}
+		}
+		err := tx.GetContext(ctx, &res, query, bound...)
+		if !errors.Is(err, sql.ErrNoRows) || p.Test.Empty() {
+			return err
+		}
+		// No row matched: either the product is gone or a test failed.
+		var exists bool
+		if err := tx.GetContext(ctx, &exists, "select exists(select 1 from products where prod_id = $1)", p.ProductID); err != nil {
+			return err
 		}
-	} else {
-		return models.Product{}, fmt.Errorf("product_repo.Update: %w", sql.ErrNoRows)
+		if exists {
+			return utils.ErrPatchTestFailed
+		}
+		return err
+	})
+	if err != nil {
+		return models.Product{}, fmt.Errorf("product_repo.Update: %w", err)
 	}
-
+	span.AddEvent("query executed")
 	return res, nil
 }
 
-func (r pgProductRepo) DeleteByID(ctx context.Context, id string) (models.Product, error) {
+func (r pgProductRepo) DeleteByID(ctx context.Context, id string) (_ models.Product, err error) {
 	const query = "delete from products where prod_id = $1 returning *"
+	ctx, span := startSpan(ctx, "product_repo.DeleteByID")
+	span.SetAttributes(semconv.DBQueryText(query))
+	defer func() { tracing.End(span, err) }()
 
 	var result models.Product
-	err := r.db.GetContext(ctx, &result, query, id)
+	err = runInTx(ctx, r.db, func(tx *sqlx.Tx) error {
+		return tx.GetContext(ctx, &result, query, id)
+	})
 	if err != nil {
-		return result, fmt.Errorf("product_repo.DeleteByID: %w", err)
+		return models.Product{}, fmt.Errorf("product_repo.DeleteByID: %w", err)
 	}
 	return result, nil
 }
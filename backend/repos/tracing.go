@@ -0,0 +1,23 @@
+package repos
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/avnpl/go-march/repos")
+
+// statementNameKey names the repo call a query belongs to, the same name that
+// prefixes its errors (e.g. product_repo.UpdateByID).
+const statementNameKey = attribute.Key("db.statement.name")
+
+func startSpan(ctx context.Context, statement string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, statement,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, statementNameKey.String(statement)),
+	)
+}
@@ -0,0 +1,58 @@
+package repos
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type TTLRepo interface {
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+type pgTTLRepo struct {
+	db *sqlx.DB
+}
+
+func NewPGTTLRepo(db *sqlx.DB) TTLRepo {
+	return pgTTLRepo{db: db}
+}
+
+// Children are deleted before their parents, and a child goes together with an
+// expired parent even if its own expiry is later, so no foreign key blocks the
+// delete. Seed rows have no expiry and are never matched.
+var expiredRowDeletes = []string{
+	`delete from payments where ttl_expires_at <= now()
+		or order_id in (
+			select order_id from orders where ttl_expires_at <= now()
+			or product_id in (select prod_id from products where ttl_expires_at <= now())
+		)`,
+	`delete from orders where ttl_expires_at <= now()
+		or product_id in (select prod_id from products where ttl_expires_at <= now())`,
+	"delete from products where ttl_expires_at <= now()",
+	"delete from card_tokens where ttl_expires_at <= now()",
+}
+
+func (r pgTTLRepo) DeleteExpired(ctx context.Context) (int64, error) {
+	var deleted int64
+	err := runInTx(ctx, r.db, func(tx *sqlx.Tx) error {
+		deleted = 0
+		for _, query := range expiredRowDeletes {
+			result, err := tx.ExecContext(ctx, query)
+			if err != nil {
+				return err
+			}
+			n, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			deleted += n
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("ttl_repo.DeleteExpired: %w", err)
+	}
+	return deleted, nil
+}
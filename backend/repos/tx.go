@@ -0,0 +1,74 @@
+package repos
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/avnpl/go-march/utils"
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Retry budget for transactions that lose a serialization conflict. The delay
+// doubles per attempt up to txMaxDelay, with jitter so that the transactions
+// that collided do not collide again.
+const (
+	txMaxAttempts = 5
+	txBaseDelay   = 10 * time.Millisecond
+	txMaxDelay    = 500 * time.Millisecond
+)
+
+// runInTx runs fn in a transaction and commits it. When the database aborts
+// the transaction with SQLSTATE 40001, which CockroachDB does under contention
+// and expects the client to handle, the whole transaction is run again. fn may
+// therefore run more than once and must not have side effects outside tx.
+//
+// The returned error is already translated by dbError.
+func runInTx(ctx context.Context, db *sqlx.DB, fn func(tx *sqlx.Tx) error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = dbError(runTxOnce(ctx, db, fn))
+		if err == nil || !errors.Is(err, utils.ErrSerializationFailure) || attempt == txMaxAttempts {
+			return err
+		}
+
+		delay := retryDelay(attempt)
+		trace.SpanFromContext(ctx).AddEvent("retrying transaction", trace.WithAttributes(
+			attribute.Int("db.tx.attempt", attempt),
+			attribute.String("db.tx.delay", delay.String()),
+		))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+func runTxOnce(ctx context.Context, db *sqlx.DB, fn func(tx *sqlx.Tx) error) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func retryDelay(attempt int) time.Duration {
+	delay := txBaseDelay << (attempt - 1)
+	if delay > txMaxDelay {
+		delay = txMaxDelay
+	}
+	// Jitter within the upper half spreads retries out but never makes them immediate.
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/avnpl/go-march/models"
+	"github.com/avnpl/go-march/repos"
+	"github.com/avnpl/go-march/utils"
+	"go.uber.org/zap"
+)
+
+// CardVault swaps card numbers for opaque tokens. The card number only lives
+// for the duration of Tokenize, everything downstream works with the token.
+type CardVault interface {
+	Tokenize(ctx context.Context, req *models.TokenizeCardReq) (models.Card, error)
+	Resolve(ctx context.Context, token string) (models.Card, error)
+}
+
+type cardVault struct {
+	repo repos.CardRepo
+	ttl  time.Duration
+	log  *zap.Logger
+	now  func() time.Time
+}
+
+func NewCardVault(r repos.CardRepo, ttl time.Duration, l *zap.Logger) CardVault {
+	return &cardVault{repo: r, ttl: ttl, log: l, now: time.Now}
+}
+
+func (v *cardVault) Tokenize(ctx context.Context, req *models.TokenizeCardReq) (models.Card, error) {
+	if !utils.LuhnValid(req.CardNumber) {
+		return models.Card{}, fmt.Errorf("card_vault.Tokenize: %w", utils.ErrInvalidCard)
+	}
+	if v.expired(req.ExpMonth, req.ExpYear) {
+		return models.Card{}, fmt.Errorf("card_vault.Tokenize: %w", utils.ErrCardExpired)
+	}
+
+	token, err := newCardToken()
+	if err != nil {
+		return models.Card{}, fmt.Errorf("card_vault.Tokenize: %w", err)
+	}
+
+	c := models.Card{
+		Token:        token,
+		Brand:        utils.CardBrand(req.CardNumber),
+		CardLastFour: req.CardNumber[len(req.CardNumber)-4:],
+		ExpMonth:     req.ExpMonth,
+		ExpYear:      req.ExpYear,
+		TTLExpires:   expiresAt(v.ttl),
+	}
+
+	res, err := v.repo.Create(ctx, &c)
+	if err != nil {
+		return models.Card{}, fmt.Errorf("card_vault.Tokenize: %w", err)
+	}
+
+	utils.LoggerFrom(ctx, v.log).Info("tokenized card",
+		zap.String("brand", res.Brand),
+		zap.String("card_last_four", res.CardLastFour),
+	)
+	return res, nil
+}
+
+func (v *cardVault) Resolve(ctx context.Context, token string) (models.Card, error) {
+	res, err := v.repo.FetchByToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, utils.ErrRecordNotFound) {
+			return models.Card{}, fmt.Errorf("card_vault.Resolve: %w", utils.ErrCardNotFound)
+		}
+		return models.Card{}, fmt.Errorf("card_vault.Resolve: %w", err)
+	}
+
+	if v.expired(res.ExpMonth, res.ExpYear) {
+		return models.Card{}, fmt.Errorf("card_vault.Resolve: %w", utils.ErrCardExpired)
+	}
+	return res, nil
+}
+
+// A card is valid through the last day of its expiry month.
+func (v *cardVault) expired(month int, year int) bool {
+	firstOfNextMonth := time.Date(year, time.Month(month)+1, 1, 0, 0, 0, 0, time.UTC)
+	return !v.now().UTC().Before(firstOfNextMonth)
+}
+
+func newCardToken() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "tok_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/avnpl/go-march/models"
+	"github.com/avnpl/go-march/money"
+	"github.com/avnpl/go-march/repos"
+	"github.com/avnpl/go-march/utils"
+	"go.uber.org/zap"
+)
+
+// DefaultCurrency is the currency of products created without one, and the
+// first currency tried when converting through a third one.
+const DefaultCurrency = "USD"
+
+var currencyCodePattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+type CurrencyService interface {
+	GetCurrencies(ctx context.Context) ([]models.Currency, error)
+	SaveCurrency(ctx context.Context, code string, req *models.SaveCurrencyReq) (models.Currency, error)
+	GetRates(ctx context.Context) ([]models.ExchangeRate, error)
+	SetRate(ctx context.Context, base string, quote string, req *models.SetExchangeRateReq) (models.ExchangeRate, error)
+	DeleteRate(ctx context.Context, base string, quote string) (models.ExchangeRate, error)
+	// ConvertProducts rewrites the price and currency of products in place.
+	ConvertProducts(ctx context.Context, products []models.Product, currency string) error
+	// ConvertOrders rewrites the total and currency of orders in place.
+	ConvertOrders(ctx context.Context, orders []models.Orders, currency string) error
+}
+
+type currencyService struct {
+	repo repos.CurrencyRepo
+	log  *zap.Logger
+}
+
+func NewCurrencyService(r repos.CurrencyRepo, l *zap.Logger) CurrencyService {
+	return &currencyService{repo: r, log: l}
+}
+
+// NormalizeCurrency upper-cases a currency code and checks its shape.
+func NormalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if !currencyCodePattern.MatchString(code) {
+		return "", utils.ErrUnknownCurrency
+	}
+	return code, nil
+}
+
+func (s *currencyService) GetCurrencies(ctx context.Context) ([]models.Currency, error) {
+	res, err := s.repo.FetchAll(ctx)
+	if err != nil {
+		return res, fmt.Errorf("currency_service.GetCurrencies: %w", err)
+	}
+	return res, nil
+}
+
+func (s *currencyService) SaveCurrency(ctx context.Context, code string, req *models.SaveCurrencyReq) (models.Currency, error) {
+	code, err := NormalizeCurrency(code)
+	if err != nil {
+		return models.Currency{}, fmt.Errorf("currency_service.SaveCurrency: %w", err)
+	}
+
+	res, err := s.repo.Upsert(ctx, &models.Currency{Code: code, Name: req.Name, MinorUnits: *req.MinorUnits})
+	if err != nil {
+		return models.Currency{}, fmt.Errorf("currency_service.SaveCurrency: %w", err)
+	}
+
+	utils.LoggerFrom(ctx, s.log).Info("saved currency", zap.String("currency", res.Code))
+	return res, nil
+}
+
+func (s *currencyService) GetRates(ctx context.Context) ([]models.ExchangeRate, error) {
+	res, err := s.repo.FetchRates(ctx)
+	if err != nil {
+		return res, fmt.Errorf("currency_service.GetRates: %w", err)
+	}
+	return res, nil
+}
+
+func (s *currencyService) SetRate(ctx context.Context, base string, quote string, req *models.SetExchangeRateReq) (models.ExchangeRate, error) {
+	base, quote, err := ratePair(base, quote)
+	if err != nil {
+		return models.ExchangeRate{}, fmt.Errorf("currency_service.SetRate: %w", err)
+	}
+	rate, err := money.ParseRate(req.Rate.String())
+	if err != nil {
+		return models.ExchangeRate{}, fmt.Errorf("currency_service.SetRate: %w", utils.InField("rate", fmt.Errorf("%w: %v", utils.ErrInvalidRequest, err)))
+	}
+
+	res, err := s.repo.UpsertRate(ctx, &models.ExchangeRate{Base: base, Quote: quote, Rate: rate.FloatString(money.RateScale)})
+	if err != nil {
+		return models.ExchangeRate{}, fmt.Errorf("currency_service.SetRate: %w", err)
+	}
+
+	utils.LoggerFrom(ctx, s.log).Info("set exchange rate",
+		zap.String("base", res.Base),
+		zap.String("quote", res.Quote),
+		zap.String("rate", res.Rate),
+	)
+	return res, nil
+}
+
+func (s *currencyService) DeleteRate(ctx context.Context, base string, quote string) (models.ExchangeRate, error) {
+	base, quote, err := ratePair(base, quote)
+	if err != nil {
+		return models.ExchangeRate{}, fmt.Errorf("currency_service.DeleteRate: %w", err)
+	}
+
+	res, err := s.repo.DeleteRate(ctx, base, quote)
+	if err != nil {
+		return models.ExchangeRate{}, fmt.Errorf("currency_service.DeleteRate: %w", err)
+	}
+
+	utils.LoggerFrom(ctx, s.log).Info("deleted exchange rate", zap.String("base", res.Base), zap.String("quote", res.Quote))
+	return res, nil
+}
+
+func ratePair(base string, quote string) (string, string, error) {
+	base, err := NormalizeCurrency(base)
+	if err != nil {
+		return "", "", utils.InField("base", err)
+	}
+	quote, err = NormalizeCurrency(quote)
+	if err != nil {
+		return "", "", utils.InField("quote", err)
+	}
+	if base == quote {
+		return "", "", utils.InField("quote", utils.ErrInvalidRequest)
+	}
+	return base, quote, nil
+}
+
+func (s *currencyService) ConvertProducts(ctx context.Context, products []models.Product, currency string) error {
+	rates, currency, err := s.rateTable(ctx, currency)
+	if err != nil {
+		return fmt.Errorf("currency_service.ConvertProducts: %w", err)
+	}
+	for i := range products {
+		price, err := rates.convert(products[i].Price, products[i].Currency, currency)
+		if err != nil {
+			return fmt.Errorf("currency_service.ConvertProducts: %s: %w", products[i].ProductID, err)
+		}
+		products[i].Price, products[i].Currency = price, currency
+	}
+	return nil
+}
+
+func (s *currencyService) ConvertOrders(ctx context.Context, orders []models.Orders, currency string) error {
+	rates, currency, err := s.rateTable(ctx, currency)
+	if err != nil {
+		return fmt.Errorf("currency_service.ConvertOrders: %w", err)
+	}
+	for i := range orders {
+		total, err := rates.convert(orders[i].TotalPrice, orders[i].Currency, currency)
+		if err != nil {
+			return fmt.Errorf("currency_service.ConvertOrders: %s: %w", orders[i].OrderID, err)
+		}
+		orders[i].TotalPrice, orders[i].Currency = total, currency
+	}
+	return nil
+}
+
+// rateTable loads every currency and rate once per conversion request, the
+// tables are small and this keeps a whole response on one set of rates.
+func (s *currencyService) rateTable(ctx context.Context, currency string) (rateTable, string, error) {
+	currency, err := NormalizeCurrency(currency)
+	if err != nil {
+		return rateTable{}, "", err
+	}
+
+	currencies, err := s.repo.FetchAll(ctx)
+	if err != nil {
+		return rateTable{}, "", err
+	}
+	rates, err := s.repo.FetchRates(ctx)
+	if err != nil {
+		return rateTable{}, "", err
+	}
+
+	t := rateTable{minorUnits: make(map[string]int, len(currencies)), rates: make(map[[2]string]*big.Rat, len(rates))}
+	for _, c := range currencies {
+		t.minorUnits[c.Code] = c.MinorUnits
+		t.codes = append(t.codes, c.Code)
+	}
+	sort.Strings(t.codes)
+	for _, r := range rates {
+		rate, err := money.ParseRate(r.Rate)
+		if err != nil {
+			return rateTable{}, "", fmt.Errorf("rate %s/%s: %w", r.Base, r.Quote, err)
+		}
+		t.rates[[2]string{r.Base, r.Quote}] = rate
+	}
+
+	if _, ok := t.minorUnits[currency]; !ok {
+		return rateTable{}, "", utils.ErrUnknownCurrency
+	}
+	return t, currency, nil
+}
+
+type rateTable struct {
+	codes      []string
+	minorUnits map[string]int
+	rates      map[[2]string]*big.Rat
+}
+
+// convert applies the exact rate from -> to and rounds once, half away from
+// zero, to the minor units of the target currency.
+func (t rateTable) convert(amount money.Amount, from string, to string) (money.Amount, error) {
+	if from == to {
+		return amount, nil
+	}
+	rate, ok := t.rate(from, to)
+	if !ok {
+		return 0, utils.ErrNoExchangeRate
+	}
+	return amount.Convert(rate, t.minorUnits[to])
+}
+
+// rate uses a stored rate in either direction, or crosses through a third
+// currency (the default one first) when no rate links the pair directly.
+func (t rateTable) rate(from string, to string) (*big.Rat, bool) {
+	if r, ok := t.direct(from, to); ok {
+		return r, true
+	}
+
+	pivots := append([]string{DefaultCurrency}, t.codes...)
+	for _, via := range pivots {
+		if via == from || via == to {
+			continue
+		}
+		first, ok := t.direct(from, via)
+		if !ok {
+			continue
+		}
+		second, ok := t.direct(via, to)
+		if !ok {
+			continue
+		}
+		return new(big.Rat).Mul(first, second), true
+	}
+	return nil, false
+}
+
+func (t rateTable) direct(from string, to string) (*big.Rat, bool) {
+	if r, ok := t.rates[[2]string{from, to}]; ok {
+		return r, true
+	}
+	if r, ok := t.rates[[2]string{to, from}]; ok {
+		return new(big.Rat).Inv(r), true
+	}
+	return nil, false
+}
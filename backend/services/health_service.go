@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/avnpl/go-march/models"
+)
+
+const (
+	HealthStatusOK   = "ok"
+	HealthStatusFail = "fail"
+)
+
+var ErrShuttingDown = errors.New("server is shutting down")
+
+// HealthCheck is one dependency readiness depends on, e.g. the database.
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+type HealthService interface {
+	// Ready returns the first failing check, or ErrShuttingDown once draining.
+	Ready(ctx context.Context) error
+	Report(ctx context.Context) models.HealthReport
+	// StartDraining makes every later readiness check fail so load balancers
+	// stop routing here before the server shuts down.
+	StartDraining()
+}
+
+type healthService struct {
+	checks   []HealthCheck
+	timeout  time.Duration
+	draining atomic.Bool
+}
+
+// NewHealthService runs checks concurrently, each bounded by timeout.
+func NewHealthService(timeout time.Duration, checks ...HealthCheck) HealthService {
+	return &healthService{checks: checks, timeout: timeout}
+}
+
+func (s *healthService) StartDraining() {
+	s.draining.Store(true)
+}
+
+func (s *healthService) Ready(ctx context.Context) error {
+	if s.draining.Load() {
+		return ErrShuttingDown
+	}
+	for _, res := range s.run(ctx) {
+		if res.err != nil {
+			return res.err
+		}
+	}
+	return nil
+}
+
+func (s *healthService) Report(ctx context.Context) models.HealthReport {
+	report := models.HealthReport{Status: HealthStatusOK}
+
+	shutdown := models.HealthCheckResult{Name: "shutdown", Status: HealthStatusOK}
+	if s.draining.Load() {
+		shutdown.Status = HealthStatusFail
+		shutdown.Error = ErrShuttingDown.Error()
+		report.Status = HealthStatusFail
+	}
+
+	for _, res := range s.run(ctx) {
+		check := models.HealthCheckResult{
+			Name:      res.name,
+			Status:    HealthStatusOK,
+			LatencyMS: float64(res.latency.Microseconds()) / 1000,
+		}
+		if res.err != nil {
+			check.Status = HealthStatusFail
+			check.Error = res.err.Error()
+			report.Status = HealthStatusFail
+		}
+		report.Checks = append(report.Checks, check)
+	}
+	report.Checks = append(report.Checks, shutdown)
+	return report
+}
+
+type healthResult struct {
+	name    string
+	latency time.Duration
+	err     error
+}
+
+func (s *healthService) run(ctx context.Context) []healthResult {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	results := make([]healthResult, len(s.checks))
+	var wg sync.WaitGroup
+	for i, c := range s.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			err := c.Check(ctx)
+			results[i] = healthResult{name: c.Name, latency: time.Since(start), err: err}
+		}()
+	}
+	wg.Wait()
+	return results
+}
@@ -1 +1,178 @@
 package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/avnpl/go-march/events"
+	"github.com/avnpl/go-march/models"
+	"github.com/avnpl/go-march/repos"
+	"github.com/avnpl/go-march/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	OrderStatusPending = "pending"
+	OrderStatusPaid    = "paid"
+	OrderStatusFailed  = "failed"
+)
+
+const (
+	DefaultOrderPageSize = 20
+	MaxOrderPageSize     = 100
+)
+
+type OrderService interface {
+	CreateOrder(ctx context.Context, req *models.CreateOrderReq) (models.Orders, error)
+	GetOrderByID(ctx context.Context, id string) (models.Orders, error)
+	GetAllOrders(ctx context.Context) ([]models.Orders, error)
+	GetOrderPage(ctx context.Context, opts models.OrderListOpts) (models.OrderPage, error)
+	UpdateOrder(ctx context.Context, id string, req *models.UpdateOrderReq) (models.Orders, error)
+}
+
+type orderService struct {
+	repo        repos.OrderRepo
+	productRepo repos.ProductRepo
+	ttl         time.Duration
+	bus         *events.Bus
+	log         *zap.Logger
+}
+
+func NewOrderService(r repos.OrderRepo, pr repos.ProductRepo, ttl time.Duration, bus *events.Bus, l *zap.Logger) OrderService {
+	return &orderService{repo: r, productRepo: pr, ttl: ttl, bus: bus, log: l}
+}
+
+func (s *orderService) CreateOrder(ctx context.Context, req *models.CreateOrderReq) (models.Orders, error) {
+	prod, err := s.productRepo.FetchByID(ctx, req.ProductID)
+	if err != nil {
+		if errors.Is(err, utils.ErrRecordNotFound) {
+			return models.Orders{}, fmt.Errorf("order_service.Create: %w", utils.ErrProductNotFound)
+		}
+		return models.Orders{}, fmt.Errorf("order_service.Create: %w", err)
+	}
+
+	// Fail fast here, the repo re-checks the stock under the write lock.
+	if prod.Stock < req.Quantity {
+		return models.Orders{}, fmt.Errorf("order_service.Create: %w", utils.ErrInsufficientStock)
+	}
+
+	o := models.Orders{
+		OrderID:         utils.GenerateID("OR"),
+		ProductID:       req.ProductID,
+		Quantity:        req.Quantity,
+		Status:          OrderStatusPending,
+		ShippingAddress: req.ShippingAddress,
+		Notes:           req.Notes,
+		TTLExpires:      expiresAt(s.ttl),
+	}
+
+	res, err := s.repo.Create(ctx, &o)
+	if err != nil {
+		return models.Orders{}, fmt.Errorf("order_service.Create: %w", err)
+	}
+
+	utils.LoggerFrom(ctx, s.log).Info("created order",
+		zap.String("order_id", res.OrderID),
+		zap.String("prod_id", res.ProductID),
+		zap.Int("quantity", res.Quantity),
+	)
+
+	// The order took stock, subscribers get the product as it is now.
+	if prod, err := s.productRepo.FetchByID(ctx, res.ProductID); err == nil {
+		s.bus.Publish(events.Event{Topic: events.ProductUpdated, Product: prod})
+		s.bus.Publish(events.Event{Topic: events.StockChanged, Product: prod})
+	} else {
+		utils.LoggerFrom(ctx, s.log).Warn("cannot publish stock change", zap.String("prod_id", res.ProductID), zap.Error(err))
+	}
+	return res, nil
+}
+
+func (s *orderService) GetOrderByID(ctx context.Context, id string) (models.Orders, error) {
+	res, err := s.repo.FetchByID(ctx, id)
+	if err != nil {
+		return res, fmt.Errorf("order_service.Get: %w", err)
+	}
+	return res, nil
+}
+
+func (s *orderService) GetAllOrders(ctx context.Context) ([]models.Orders, error) {
+	res, err := s.repo.FetchAll(ctx)
+	if err != nil {
+		return res, fmt.Errorf("order_service.GetAll: %w", err)
+	}
+	return res, nil
+}
+
+func (s *orderService) GetOrderPage(ctx context.Context, opts models.OrderListOpts) (models.OrderPage, error) {
+	if opts.Limit < 0 || opts.Limit > MaxOrderPageSize {
+		return models.OrderPage{}, fmt.Errorf("order_service.GetPage: limit %d: %w", opts.Limit, utils.InField("first", utils.ErrInvalidRequest))
+	}
+	if opts.Limit == 0 {
+		opts.Limit = DefaultOrderPageSize
+	}
+	switch opts.Status {
+	case "", OrderStatusPending, OrderStatusPaid, OrderStatusFailed:
+	default:
+		return models.OrderPage{}, fmt.Errorf("order_service.GetPage: status %q: %w", opts.Status, utils.InField("status", utils.ErrInvalidRequest))
+	}
+
+	var after *models.OrderCursor
+	if opts.Cursor != "" {
+		cursor, err := decodeOrderCursor(opts.Cursor)
+		if err != nil {
+			return models.OrderPage{}, fmt.Errorf("order_service.GetPage: %w", utils.ErrInvalidCursor)
+		}
+		after = &cursor
+	}
+
+	// Fetch one extra row to learn whether another page follows.
+	fetch := opts
+	fetch.Limit = opts.Limit + 1
+	orders, err := s.repo.FetchPage(ctx, &fetch, after)
+	if err != nil {
+		return models.OrderPage{}, fmt.Errorf("order_service.GetPage: %w", err)
+	}
+
+	res := models.OrderPage{Orders: orders}
+	if len(orders) > opts.Limit {
+		res.Orders = orders[:opts.Limit]
+		next := encodeOrderCursor(res.Orders[opts.Limit-1])
+		res.NextCursor = &next
+	}
+	return res, nil
+}
+
+func (s *orderService) UpdateOrder(ctx context.Context, id string, req *models.UpdateOrderReq) (models.Orders, error) {
+	req.TTLExpires = expiresAt(s.ttl)
+	res, err := s.repo.UpdateByID(ctx, id, req)
+	if err != nil {
+		return models.Orders{}, fmt.Errorf("order_service.Update: %w", err)
+	}
+	utils.LoggerFrom(ctx, s.log).Info("updated order", zap.String("order_id", res.OrderID))
+	return res, nil
+}
+
+func encodeOrderCursor(last models.Orders) string {
+	raw, _ := json.Marshal(models.OrderCursor{OrderTime: last.CreatedAt, OrderID: last.OrderID})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeOrderCursor(encoded string) (models.OrderCursor, error) {
+	var cursor models.OrderCursor
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cursor, err
+	}
+	if err := json.Unmarshal(raw, &cursor); err != nil {
+		return cursor, err
+	}
+	if cursor.OrderID == "" {
+		return cursor, utils.ErrInvalidCursor
+	}
+	return cursor, nil
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/avnpl/go-march/events"
+	"github.com/avnpl/go-march/models"
+	"github.com/avnpl/go-march/repos"
+	"github.com/avnpl/go-march/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	PaymentStatusSuccess = "success"
+	PaymentStatusFailed  = "failed"
+
+	// Cards ending in this suffix are always declined so clients can test the
+	// failure path deterministically.
+	declinedCardSuffix = "6969"
+)
+
+type PaymentService interface {
+	CreatePayment(ctx context.Context, req *models.CreatePaymentReq) (models.Payment, error)
+	GetPaymentByID(ctx context.Context, id string) (models.Payment, error)
+}
+
+type paymentService struct {
+	repo      repos.PaymentRepo
+	orderRepo repos.OrderRepo
+	vault     CardVault
+	ttl       time.Duration
+	bus       *events.Bus
+	log       *zap.Logger
+}
+
+func NewPaymentService(r repos.PaymentRepo, or repos.OrderRepo, v CardVault, ttl time.Duration, bus *events.Bus, l *zap.Logger) PaymentService {
+	return &paymentService{repo: r, orderRepo: or, vault: v, ttl: ttl, bus: bus, log: l}
+}
+
+func (s *paymentService) CreatePayment(ctx context.Context, req *models.CreatePaymentReq) (models.Payment, error) {
+	order, err := s.orderRepo.FetchByID(ctx, req.OrderID)
+	if err != nil {
+		if errors.Is(err, utils.ErrRecordNotFound) {
+			return models.Payment{}, fmt.Errorf("payment_service.Create: %w", utils.ErrOrderNotFound)
+		}
+		return models.Payment{}, fmt.Errorf("payment_service.Create: %w", err)
+	}
+
+	if order.Status != OrderStatusPending {
+		return models.Payment{}, fmt.Errorf("payment_service.Create: %w", utils.ErrOrderNotPayable)
+	}
+
+	card, err := s.card(ctx, req)
+	if err != nil {
+		return models.Payment{}, fmt.Errorf("payment_service.Create: %w", err)
+	}
+
+	paymentStatus, orderStatus := authorize(card)
+	p := models.Payment{
+		PaymentID:    utils.GenerateID("PA"),
+		OrderID:      order.OrderID,
+		Amount:       order.TotalPrice,
+		Currency:     order.Currency,
+		Status:       paymentStatus,
+		CardToken:    sql.NullString{String: card.Token, Valid: true},
+		CardBrand:    card.Brand,
+		CardLastFour: card.CardLastFour,
+		TTLExpires:   expiresAt(s.ttl),
+	}
+
+	res, updated, err := s.repo.Create(ctx, &p, orderStatus)
+	if err != nil {
+		return models.Payment{}, fmt.Errorf("payment_service.Create: %w", err)
+	}
+
+	utils.LoggerFrom(ctx, s.log).Info("created payment",
+		zap.String("payment_id", res.PaymentID),
+		zap.String("order_id", res.OrderID),
+		zap.String("status", res.Status),
+	)
+
+	s.bus.Publish(events.Event{Topic: events.OrderStatusChanged, Order: updated})
+	return res, nil
+}
+
+func (s *paymentService) GetPaymentByID(ctx context.Context, id string) (models.Payment, error) {
+	res, err := s.repo.FetchByID(ctx, id)
+	if err != nil {
+		return res, fmt.Errorf("payment_service.Get: %w", err)
+	}
+	return res, nil
+}
+
+func (s *paymentService) card(ctx context.Context, req *models.CreatePaymentReq) (models.Card, error) {
+	if req.Card != nil {
+		card, err := s.vault.Tokenize(ctx, req.Card)
+		return card, utils.InField("card", err)
+	}
+	return s.vault.Resolve(ctx, req.CardToken)
+}
+
+// authorize decides the outcome from the vaulted card, the simulator never
+// sees the card number itself.
+func authorize(card models.Card) (paymentStatus string, orderStatus string) {
+	if card.CardLastFour == declinedCardSuffix {
+		return PaymentStatusFailed, OrderStatusFailed
+	}
+	return PaymentStatusSuccess, OrderStatusPaid
+}
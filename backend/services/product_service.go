@@ -2,51 +2,82 @@ package services
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/avnpl/go-march/events"
 	"github.com/avnpl/go-march/models"
 	"github.com/avnpl/go-march/repos"
+	"github.com/avnpl/go-march/tracing"
 	"github.com/avnpl/go-march/utils"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
+const (
+	DefaultProductPageSize = 20
+	MaxProductPageSize     = 100
+	defaultProductSort     = "created_at"
+)
+
 type ProductService interface {
 	CreateProduct(ctx context.Context, req *models.CreateProductReq) (models.Product, error)
 	GetProductByID(ctx context.Context, id string) (models.Product, error)
-	GetAllProducts(ctx context.Context) ([]models.Product, error)
+	GetProductsByIDs(ctx context.Context, ids []string) ([]models.Product, error)
+	GetAllProducts(ctx context.Context, opts models.ProductListOpts) (models.ProductPage, error)
 	UpdateProduct(ctx context.Context, req *models.UpdateProductReq) (models.Product, error)
 	DeleteProduct(ctx context.Context, id string) (models.Product, error)
 }
 
 type productService struct {
 	repo repos.ProductRepo
+	ttl  time.Duration
+	bus  *events.Bus
 	log  *zap.Logger
 }
 
-func NewProductService(r repos.ProductRepo, l *zap.Logger) ProductService {
-	return &productService{repo: r, log: l}
+func NewProductService(r repos.ProductRepo, ttl time.Duration, bus *events.Bus, l *zap.Logger) ProductService {
+	return &productService{repo: r, ttl: ttl, bus: bus, log: l}
 }
 
-func (s *productService) CreateProduct(ctx context.Context, req *models.CreateProductReq) (models.Product, error) {
+func (s *productService) CreateProduct(ctx context.Context, req *models.CreateProductReq) (_ models.Product, err error) {
+	ctx, span := tracer.Start(ctx, "ProductService.CreateProduct")
+	defer func() { tracing.End(span, err) }()
+
+	currency := req.Currency
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+
 	p := models.Product{
-		Name:      req.Name,
-		Price:     req.Price,
-		Stock:     req.Stock,
-		ProductID: utils.GenerateID("PR"),
+		Name:       req.Name,
+		Price:      req.Price,
+		Currency:   currency,
+		Stock:      req.Stock,
+		ProductID:  utils.GenerateID("PR"),
+		TTLExpires: expiresAt(s.ttl),
 	}
+	span.SetAttributes(attribute.String("prod_id", p.ProductID))
 
 	res, err := s.repo.Create(ctx, &p)
 	if err != nil {
 		return models.Product{}, fmt.Errorf("product_service.Create: %w", err)
 	}
 
-	s.log.Info("created product", zap.String("prod_id", p.ProductID))
+	utils.LoggerFrom(ctx, s.log).Info("created product", zap.String("prod_id", p.ProductID))
 	return res, nil
 }
 
-func (s *productService) GetProductByID(ctx context.Context, id string) (models.Product, error) {
+func (s *productService) GetProductByID(ctx context.Context, id string) (_ models.Product, err error) {
+	ctx, span := tracer.Start(ctx, "ProductService.GetProductByID")
+	span.SetAttributes(attribute.String("prod_id", id))
+	defer func() { tracing.End(span, err) }()
+
 	var res models.Product
-	res, err := s.repo.FetchByID(ctx, id)
+	res, err = s.repo.FetchByID(ctx, id)
 	if err != nil {
 		return res, fmt.Errorf("product_service.Get: %w", err)
 	}
@@ -54,29 +85,140 @@ func (s *productService) GetProductByID(ctx context.Context, id string) (models.
 	return res, nil
 }
 
-func (s *productService) GetAllProducts(ctx context.Context) ([]models.Product, error) {
-	res, err := s.repo.FetchAll(ctx)
+func (s *productService) GetProductsByIDs(ctx context.Context, ids []string) (_ []models.Product, err error) {
+	ctx, span := tracer.Start(ctx, "ProductService.GetProductsByIDs")
+	span.SetAttributes(attribute.Int("ids", len(ids)))
+	defer func() { tracing.End(span, err) }()
+
+	res, err := s.repo.FetchByIDs(ctx, ids)
+	if err != nil {
+		return res, fmt.Errorf("product_service.GetByIDs: %w", err)
+	}
+	return res, nil
+}
+
+func (s *productService) GetAllProducts(ctx context.Context, opts models.ProductListOpts) (_ models.ProductPage, err error) {
+	ctx, span := tracer.Start(ctx, "ProductService.GetAllProducts")
+	defer func() { tracing.End(span, err) }()
+
+	if opts.Limit < 0 || opts.Limit > MaxProductPageSize {
+		return models.ProductPage{}, fmt.Errorf("product_service.GetAll: limit %d: %w", opts.Limit, utils.ErrInvalidRequest)
+	}
+	if opts.Limit == 0 {
+		opts.Limit = DefaultProductPageSize
+	}
+	if opts.Sort == "" {
+		opts.Sort = defaultProductSort
+	}
+	if _, ok := models.ProductSortColumns[strings.TrimPrefix(opts.Sort, "-")]; !ok {
+		return models.ProductPage{}, fmt.Errorf("product_service.GetAll: sort %q: %w", opts.Sort, utils.ErrInvalidRequest)
+	}
+
+	if opts.PriceCurrency != "" {
+		currency, err := NormalizeCurrency(opts.PriceCurrency)
+		if err != nil {
+			return models.ProductPage{}, fmt.Errorf("product_service.GetAll: %w", utils.InField("price_currency", err))
+		}
+		opts.PriceCurrency = currency
+	} else if opts.MinPrice != nil || opts.MaxPrice != nil || strings.TrimPrefix(opts.Sort, "-") == "price" {
+		return models.ProductPage{}, fmt.Errorf("product_service.GetAll: %w", utils.ErrCurrencyRequired)
+	}
+
+	var after *models.ProductCursor
+	if opts.Cursor != "" {
+		cursor, err := decodeProductCursor(opts.Cursor)
+		if err != nil || cursor.Sort != opts.Sort {
+			return models.ProductPage{}, fmt.Errorf("product_service.GetAll: %w", utils.ErrInvalidCursor)
+		}
+		after = &cursor
+	}
+
+	// Fetch one extra row to learn whether another page follows.
+	fetch := opts
+	fetch.Limit = opts.Limit + 1
+	prods, err := s.repo.FetchAll(ctx, &fetch, after)
 	if err != nil {
-		return res, fmt.Errorf("product_service.GetAll: %w", err)
+		return models.ProductPage{}, fmt.Errorf("product_service.GetAll: %w", err)
+	}
+
+	total, err := s.repo.Count(ctx, &opts)
+	if err != nil {
+		return models.ProductPage{}, fmt.Errorf("product_service.GetAll: %w", err)
+	}
+
+	res := models.ProductPage{Products: prods, TotalCount: total}
+	if len(prods) > opts.Limit {
+		res.Products = prods[:opts.Limit]
+		next := encodeProductCursor(opts.Sort, res.Products[opts.Limit-1])
+		res.NextCursor = &next
 	}
 	return res, nil
 }
 
-func (s *productService) UpdateProduct(ctx context.Context, req *models.UpdateProductReq) (models.Product, error) {
+func (s *productService) UpdateProduct(ctx context.Context, req *models.UpdateProductReq) (_ models.Product, err error) {
+	ctx, span := tracer.Start(ctx, "ProductService.UpdateProduct")
+	span.SetAttributes(attribute.String("prod_id", req.ProductID))
+	defer func() { tracing.End(span, err) }()
+
+	if req.Empty() {
+		return models.Product{}, fmt.Errorf("product_service.Update: %w", utils.ErrEmptyPatch)
+	}
+
+	req.TTLExpires = expiresAt(s.ttl)
 	res, err := s.repo.UpdateByID(ctx, req)
 	if err != nil {
 		return models.Product{}, fmt.Errorf("product_service.Update: %w", err)
 	}
-	s.log.Info("updated product", zap.String("prod_id", res.ProductID))
+	utils.LoggerFrom(ctx, s.log).Info("updated product", zap.String("prod_id", res.ProductID))
+
+	s.bus.Publish(events.Event{Topic: events.ProductUpdated, Product: res})
+	if req.Stock != nil {
+		s.bus.Publish(events.Event{Topic: events.StockChanged, Product: res})
+	}
 	return res, nil
 }
 
-func (s *productService) DeleteProduct(ctx context.Context, id string) (models.Product, error) {
+func (s *productService) DeleteProduct(ctx context.Context, id string) (_ models.Product, err error) {
+	ctx, span := tracer.Start(ctx, "ProductService.DeleteProduct")
+	span.SetAttributes(attribute.String("prod_id", id))
+	defer func() { tracing.End(span, err) }()
+
 	res, err := s.repo.DeleteByID(ctx, id)
 	if err != nil {
 		return models.Product{}, fmt.Errorf("prod_service.Delete: %w", err)
 	}
 
-	s.log.Info("deleted product", zap.String("prod_id", res.ProductID))
+	utils.LoggerFrom(ctx, s.log).Info("deleted product", zap.String("prod_id", res.ProductID))
 	return res, nil
 }
+
+func encodeProductCursor(sort string, last models.Product) string {
+	cursor := models.ProductCursor{Sort: sort, ProductID: last.ProductID}
+	switch strings.TrimPrefix(sort, "-") {
+	case "price":
+		cursor.Value = last.Price.String()
+	case "name":
+		cursor.Value = last.Name
+	default:
+		cursor.Value = last.CreatedAt.Format(time.RFC3339Nano)
+	}
+
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeProductCursor(encoded string) (models.ProductCursor, error) {
+	var cursor models.ProductCursor
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cursor, err
+	}
+	if err := json.Unmarshal(raw, &cursor); err != nil {
+		return cursor, err
+	}
+	if cursor.ProductID == "" {
+		return cursor, utils.ErrInvalidCursor
+	}
+	return cursor, nil
+}
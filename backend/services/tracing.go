@@ -0,0 +1,7 @@
+package services
+
+import (
+	"go.opentelemetry.io/otel"
+)
+
+var tracer = otel.Tracer("github.com/avnpl/go-march/services")
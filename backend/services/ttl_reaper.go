@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/avnpl/go-march/repos"
+	"go.uber.org/zap"
+)
+
+// expiresAt is the ttl_expires_at stamp for a row written now. Config keeps
+// the TTL at 1m or more, so user rows always expire.
+func expiresAt(ttl time.Duration) sql.NullTime {
+	return sql.NullTime{Time: time.Now().Add(ttl).UTC(), Valid: true}
+}
+
+// TTLReaper deletes expired sandbox rows on databases without native row TTL.
+type TTLReaper struct {
+	repo     repos.TTLRepo
+	interval time.Duration
+	log      *zap.Logger
+}
+
+func NewTTLReaper(r repos.TTLRepo, interval time.Duration, l *zap.Logger) *TTLReaper {
+	return &TTLReaper{repo: r, interval: interval, log: l}
+}
+
+// Run reaps once per interval until ctx is cancelled.
+func (t *TTLReaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	t.log.Info("ttl reaper started", zap.Duration("interval", t.interval))
+	for {
+		select {
+		case <-ctx.Done():
+			t.log.Info("ttl reaper stopped")
+			return
+		case <-ticker.C:
+			t.reap(ctx)
+		}
+	}
+}
+
+func (t *TTLReaper) reap(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, t.interval)
+	defer cancel()
+
+	deleted, err := t.repo.DeleteExpired(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			t.log.Error("ttl reap failed", zap.Error(err))
+		}
+		return
+	}
+	if deleted > 0 {
+		t.log.Info("deleted expired rows", zap.Int64("rows", deleted))
+	}
+}
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"strings"
+)
+
+// LuhnValid reports whether the digits-only PAN passes the Luhn checksum.
+func LuhnValid(pan string) bool {
+	if len(pan) < 12 || len(pan) > 19 {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(pan) - 1; i >= 0; i-- {
+		c := pan[i]
+		if c < '0' || c > '9' {
+			return false
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// CardBrand derives the network from the IIN prefix of the PAN.
+func CardBrand(pan string) string {
+	switch {
+	case strings.HasPrefix(pan, "4"):
+		return "visa"
+	case hasPrefixInRange(pan, 2, 51, 55), hasPrefixInRange(pan, 4, 2221, 2720):
+		return "mastercard"
+	case strings.HasPrefix(pan, "34"), strings.HasPrefix(pan, "37"):
+		return "amex"
+	case strings.HasPrefix(pan, "6011"), strings.HasPrefix(pan, "65"):
+		return "discover"
+	default:
+		return "unknown"
+	}
+}
+
+func hasPrefixInRange(pan string, digits int, low int, high int) bool {
+	if len(pan) < digits {
+		return false
+	}
+	prefix := 0
+	for _, c := range pan[:digits] {
+		prefix = prefix*10 + int(c-'0')
+	}
+	return prefix >= low && prefix <= high
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+type ctxKey int
+
+const (
+	requestIDKey ctxKey = iota
+	loggerKey
+)
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the ID of the request ctx belongs to, or "" outside of one.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+func WithLogger(ctx context.Context, l *zap.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, l)
+}
+
+// LoggerFrom returns the request-scoped logger stored in ctx, which carries the
+// request ID on every line, or fallback when there is none.
+func LoggerFrom(ctx context.Context, fallback *zap.Logger) *zap.Logger {
+	if ctx == nil {
+		return fallback
+	}
+	if l, ok := ctx.Value(loggerKey).(*zap.Logger); ok {
+		return l
+	}
+	return fallback
+}
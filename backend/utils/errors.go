@@ -1,17 +1,183 @@
 package utils
 
 import (
+	"encoding/json"
 	"errors"
+	"net/http"
+	"strings"
 )
 
 var (
-	ErrConflict       = errors.New("ErrConflict")
-	ErrInternal       = errors.New("Internal Error")
-	ErrInvalidRequest = errors.New("Invalid Request")
-	ErrRecordNotFound = errors.New("Record Not Found")
+	ErrConflict             = errors.New("ErrConflict")
+	ErrInternal             = errors.New("Internal Error")
+	ErrInvalidRequest       = errors.New("Invalid Request")
+	ErrRecordNotFound       = errors.New("Record Not Found")
+	ErrSerializationFailure = errors.New("Serialization Failure")
+	ErrProductNotFound      = errors.New("Product Not Found")
+	ErrInsufficientStock    = errors.New("Insufficient Stock")
+	ErrOrderNotFound        = errors.New("Order Not Found")
+	ErrOrderNotPayable      = errors.New("Order Not Payable")
+	ErrInvalidCard          = errors.New("Invalid Card")
+	ErrCardExpired          = errors.New("Card Expired")
+	ErrCardNotFound         = errors.New("Card Not Found")
+	ErrInvalidCursor        = errors.New("Invalid Cursor")
+	ErrUnknownCurrency      = errors.New("Unknown Currency")
+	ErrNoExchangeRate       = errors.New("No Exchange Rate")
+	ErrPriceTooPrecise      = errors.New("Price Too Precise")
+	ErrCurrencyRequired     = errors.New("Currency Required")
+	ErrEmptyPatch           = errors.New("Empty Patch")
+	ErrPatchTestFailed      = errors.New("Patch Test Failed")
 )
 
 type APIError struct {
-	Error   string `json:"error"`
-	Message string `json:"message"`
+	Error      string      `json:"error"`
+	Message    string      `json:"message"`
+	Field      string      `json:"field,omitempty"`
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+// DBError is a driver error translated into one of the sentinels above, with
+// the column it concerns when the database reports one. errors.Is matches both
+// the sentinel and the original driver error.
+type DBError struct {
+	Kind       error
+	Field      string
+	Constraint string
+	Err        error
+}
+
+func (e *DBError) Error() string {
+	msg := e.Kind.Error()
+	if e.Field != "" {
+		msg += " (" + e.Field + ")"
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+func (e *DBError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// FieldError places err under a request field. Fields nest, so a card error
+// on card_number inside a payment's "card" object is reported as
+// card.card_number.
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+func InField(field string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &FieldError{Field: field, Err: err}
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorResponse is how an error is presented to API clients, whatever the API
+// style. Code is stable and machine-readable, Message is safe to show.
+type ErrorResponse struct {
+	Status     int
+	Code       string
+	Message    string
+	Field      string
+	Violations []Violation
+}
+
+type errorMapping struct {
+	err     error
+	status  int
+	code    string
+	message string
+	field   string
+}
+
+// The first matching entry wins, so specific errors come before the generic
+// database ones they may also wrap.
+var errorMappings = []errorMapping{
+	{ErrProductNotFound, http.StatusNotFound, "PRODUCT_NOT_FOUND", "Product with given ID not found", "product_id"},
+	{ErrOrderNotFound, http.StatusNotFound, "ORDER_NOT_FOUND", "Order with given ID not found", "order_id"},
+	{ErrCardNotFound, http.StatusBadRequest, "CARD_NOT_FOUND", "Unknown card token", "card_token"},
+	{ErrInsufficientStock, http.StatusConflict, "INSUFFICIENT_STOCK", "Not enough stock to place the order", "quantity"},
+	{ErrOrderNotPayable, http.StatusConflict, "ORDER_NOT_PAYABLE", "Order is not pending payment", "order_id"},
+	{ErrInvalidCard, http.StatusBadRequest, "INVALID_CARD", "Card number is invalid", "card_number"},
+	{ErrCardExpired, http.StatusBadRequest, "CARD_EXPIRED", "Card has expired", "exp_year"},
+	{ErrInvalidCursor, http.StatusBadRequest, "INVALID_CURSOR", "Invalid value for cursor", "cursor"},
+	{ErrUnknownCurrency, http.StatusBadRequest, "UNKNOWN_CURRENCY", "Unknown currency code", "currency"},
+	{ErrNoExchangeRate, http.StatusBadRequest, "NO_EXCHANGE_RATE", "No exchange rate to the requested currency", "currency"},
+	{ErrPriceTooPrecise, http.StatusBadRequest, "PRICE_TOO_PRECISE", "Price has more decimal places than its currency", "price"},
+	{ErrCurrencyRequired, http.StatusBadRequest, "CURRENCY_REQUIRED", "Filtering or sorting by price needs price_currency", "price_currency"},
+	{ErrEmptyPatch, http.StatusBadRequest, "EMPTY_PATCH", "The patch does not change any field", ""},
+	{ErrPatchTestFailed, http.StatusConflict, "PATCH_TEST_FAILED", "A test operation of the patch did not match", ""},
+	{ErrRecordNotFound, http.StatusNotFound, "NOT_FOUND", "Record with given ID not found", ""},
+	{ErrConflict, http.StatusConflict, "CONFLICT", "Request conflicts with the current state of the record", ""},
+	{ErrInvalidRequest, http.StatusBadRequest, "INVALID_REQUEST", "Invalid Request", ""},
+	{ErrSerializationFailure, http.StatusServiceUnavailable, "RETRY", "The request conflicted with a concurrent one, please retry", ""},
+}
+
+// MapError is the one place that decides the status, code and message an error
+// is reported with. Anything unknown is an internal error and reveals nothing.
+func MapError(err error) ErrorResponse {
+	res := ErrorResponse{
+		Status:  http.StatusInternalServerError,
+		Code:    "INTERNAL",
+		Message: "Something went wrong",
+	}
+	for _, m := range errorMappings {
+		if errors.Is(err, m.err) {
+			res = ErrorResponse{Status: m.status, Code: m.code, Message: m.message, Field: m.field}
+			break
+		}
+	}
+	if res.Status == http.StatusInternalServerError {
+		return res
+	}
+
+	var dbErr *DBError
+	if errors.As(err, &dbErr) && dbErr.Field != "" {
+		res.Field = dbErr.Field
+	}
+	var valErr *ValidationError
+	if errors.As(err, &valErr) && len(valErr.Violations) > 0 {
+		res.Message = valErr.Error()
+		res.Field = valErr.Violations[0].Field
+		res.Violations = valErr.Violations
+	}
+
+	// Outer fields are parents of inner ones, collect them innermost last.
+	var parents []string
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if fe, ok := e.(*FieldError); ok {
+			parents = append(parents, fe.Field)
+		}
+	}
+	if len(parents) > 0 {
+		if res.Field != "" {
+			parents = append(parents, res.Field)
+		}
+		res.Field = strings.Join(parents, ".")
+	}
+	return res
+}
+
+// SendError writes err as the standard JSON error body.
+func SendError(w http.ResponseWriter, err error) {
+	res := MapError(err)
+	apiErr := APIError{
+		Error:      http.StatusText(res.Status),
+		Message:    res.Message,
+		Field:      res.Field,
+		Violations: res.Violations,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(res.Status)
+	_ = json.NewEncoder(w).Encode(apiErr)
 }
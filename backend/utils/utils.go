@@ -6,85 +6,75 @@ import (
 	"math/rand"
 	"net/http"
 	"os"
-	"strconv"
+	"path/filepath"
 	"strings"
-	"time"
 
+	"github.com/avnpl/go-march/config"
 	"github.com/jmoiron/sqlx"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-func getEnvVar(key string) string {
-	return os.Getenv(key)
-}
-
-func GetEnvVarString(key string, defaultValue string, logger *zap.Logger) string {
-	value := getEnvVar(key)
-
-	if value == "" {
-		logger.Warn("Variable not set in env")
-		return defaultValue
+// BuildLogger returns the application logger and the level it filters on,
+// which can be changed while the server runs. Production writes JSON to
+// stdout; development writes to the console and to a size-rotated log file.
+func BuildLogger(env string, cfg config.LogConfig) (*zap.Logger, zap.AtomicLevel) {
+	level := zap.NewAtomicLevel()
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		log.Fatalf("invalid log level %q: %v", cfg.Level, err)
 	}
-	return value
-}
 
-func GetEnvVarInteger(key string, defaultValue int, logger *zap.Logger) int {
-	value := getEnvVar(key)
-
-	res, err := strconv.ParseInt(value, 10, 64)
-	if err != nil {
-		logger.Error("Error converting env variable to int")
-		res = int64(defaultValue)
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = "ts"
+	encoderConfig.MessageKey = "event"
+	encoderConfig.CallerKey = "caller"
+	encoderConfig.EncodeCaller = zapcore.ShortCallerEncoder
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	encoderConfig.EncodeDuration = zapcore.SecondsDurationEncoder
+
+	if env == "production" {
+		encoderConfig.EncodeLevel = zapcore.LowercaseLevelEncoder
+		core := zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig), zapcore.Lock(os.Stdout), level)
+		return zap.New(core,
+			zap.AddCaller(),
+			zap.AddStacktrace(zap.PanicLevel),
+			zap.ErrorOutput(zapcore.Lock(os.Stderr)),
+		), level
 	}
-	return int(res)
-}
 
-func BuildLogger() *zap.Logger {
-	loggerConfig := zap.NewDevelopmentConfig()
-
-	err := os.MkdirAll("logs", 0755)
-	if err != nil {
+	if err := os.MkdirAll(filepath.Dir(cfg.File), 0755); err != nil {
 		log.Fatalf("Failed to create log directory: %v", err)
 	}
-
-	loggerConfig.Level = zap.NewAtomicLevelAt(zap.DebugLevel)
-	loggerConfig.Development = true
-	loggerConfig.EncoderConfig.TimeKey = "ts"
-	loggerConfig.EncoderConfig.MessageKey = "event"
-	loggerConfig.EncoderConfig.CallerKey = "caller"
-	loggerConfig.EncoderConfig.EncodeCaller = zapcore.ShortCallerEncoder
-	loggerConfig.EncoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
-	loggerConfig.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
-	loggerConfig.EncoderConfig.EncodeDuration = zapcore.SecondsDurationEncoder
-	loggerConfig.Encoding = "console"
-	loggerConfig.OutputPaths = []string{"stdout", "logs/app.log"}
-	loggerConfig.ErrorOutputPaths = []string{"stderr", "logs/app.log"}
-	loggerConfig.DisableStacktrace = false
-
-	logger, err := loggerConfig.Build(
-		zap.AddStacktrace(zap.ErrorLevel),
+	file := zapcore.AddSync(&lumberjack.Logger{
+		Filename:   cfg.File,
+		MaxSize:    cfg.MaxSizeMB,
+		MaxBackups: cfg.MaxBackups,
+	})
+
+	encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+	encoder := zapcore.NewConsoleEncoder(encoderConfig)
+	core := zapcore.NewTee(
+		zapcore.NewCore(encoder, zapcore.Lock(os.Stdout), level),
+		zapcore.NewCore(encoder, file, level),
 	)
-	if err != nil {
-		log.Fatal("cannot build logger", err)
-	}
-	return logger
+	return zap.New(core,
+		zap.AddCaller(),
+		zap.Development(),
+		zap.AddStacktrace(zap.ErrorLevel),
+		zap.ErrorOutput(zapcore.NewMultiWriteSyncer(zapcore.Lock(os.Stderr), file)),
+	), level
 }
 
-func GetDBPoolObject(logger *zap.Logger) *sqlx.DB {
-	dsn := getEnvVar("DB_URL")
-	if dsn == "" {
-		logger.Fatal("DB_URL not set")
-	}
-	db, err := sqlx.Connect("pgx", dsn)
+func GetDBPoolObject(cfg config.DBConfig, logger *zap.Logger) *sqlx.DB {
+	db, err := sqlx.Connect("pgx", cfg.URL)
 	if err != nil {
 		logger.Fatal("db connect failed", zap.Error(err))
 	}
 
-	lifetime := GetEnvVarInteger("DB_MAX_CONN_LIFETIME_SEC", 10, logger)
-	db.SetMaxOpenConns(GetEnvVarInteger("DB_MAX_OPEN_CONNS", 25, logger))
-	db.SetMaxIdleConns(GetEnvVarInteger("DB_MAX_IDLE_CONNS", 10, logger))
-	db.SetConnMaxLifetime(time.Duration(lifetime) * time.Second)
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 	if err := db.Ping(); err != nil {
 		logger.Fatal("db ping failed", zap.Error(err))
 	}
@@ -107,6 +97,18 @@ func SendJSONError(w http.ResponseWriter, statusCode int, message string) {
 	_ = json.NewEncoder(w).Encode(apiErr)
 }
 
+func SendJSONFieldError(w http.ResponseWriter, statusCode int, field string, message string) {
+	apiErr := APIError{
+		Error:   http.StatusText(statusCode),
+		Message: message,
+		Field:   field,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(apiErr)
+}
+
 func SendInternalError(w http.ResponseWriter) {
 	SendJSONError(w, http.StatusInternalServerError, "")
 }
@@ -1,21 +1,115 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
 
 	"github.com/go-playground/validator/v10"
 )
 
-func FormatValidationErrors(err error) string {
-	var message string
+// JSONFieldName makes the validator report fields by their JSON names, the
+// names clients know them by. Register it with RegisterTagNameFunc.
+func JSONFieldName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// Violation is one failed validation rule.
+type Violation struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationError carries every violated rule of a request. It matches
+// ErrInvalidRequest.
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return strings.Join(messages, "; ")
+}
 
-	for _, e := range err.(validator.ValidationErrors) {
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidRequest
+}
+
+// NewValidationError turns the result of validate.Struct into a
+// ValidationError. Other errors are returned as they are.
+func NewValidationError(err error) error {
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return err
+	}
+
+	res := &ValidationError{}
+	for _, e := range errs {
+		// The namespace starts with the struct name; what follows is the JSON
+		// path, e.g. card.card_number.
+		field := e.Field()
+		if _, path, ok := strings.Cut(e.Namespace(), "."); ok {
+			field = path
+		}
+		text := e.Kind() == reflect.String
+		var message string
 		switch e.Tag() {
 		case "required":
-			message = fmt.Sprintf("%s is required", e.StructField())
+			message = fmt.Sprintf("%s is required", field)
+		case "required_without":
+			message = fmt.Sprintf("%s is required when %s is not given", field, snakeCase(e.Param()))
+		case "excluded_with":
+			message = fmt.Sprintf("%s cannot be given together with %s", field, snakeCase(e.Param()))
+		case "numeric":
+			message = fmt.Sprintf("%s must contain only digits", field)
+		case "min":
+			if text {
+				message = fmt.Sprintf("%s must be at least %s characters long", field, e.Param())
+				break
+			}
+			message = fmt.Sprintf("%s must be at least %s", field, e.Param())
+		case "max":
+			if text {
+				message = fmt.Sprintf("%s must be at most %s characters long", field, e.Param())
+				break
+			}
+			message = fmt.Sprintf("%s must be at most %s", field, e.Param())
+		case "gt":
+			message = fmt.Sprintf("%s must be greater than %s", field, e.Param())
+		case "len":
+			message = fmt.Sprintf("%s must be %s characters long", field, e.Param())
+		case "uppercase":
+			message = fmt.Sprintf("%s must be upper case", field)
 		default:
-			message = "Invalid Request"
+			message = fmt.Sprintf("%s is invalid", field)
+		}
+		res.Violations = append(res.Violations, Violation{Field: field, Rule: e.Tag(), Message: message})
+	}
+	return res
+}
+
+// snakeCase turns the Go field names some rules take as parameters into the
+// JSON names used everywhere else, e.g. CardToken into card_token.
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
 		}
+		b.WriteRune(r)
 	}
-	return message
+	return b.String()
 }